@@ -0,0 +1,173 @@
+package router
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// maxFormMemory is the number of bytes of a multipart form stored in memory by BindForm,
+// the same as for r.FormValue.
+const maxFormMemory = 32 << 20
+
+// BindJSON decodes the JSON body of the request into the struct pointed to by dest.
+// Fields with the tag `bind:"required"` must be present in the body and not null;
+// their names are specified by the tag "json", as for encoding/json.
+//
+// It returns an error wrapping ErrInvalidBody if the body is not valid JSON for dest,
+// or ErrMissingField naming the first missing field. The errors of reading the body,
+// such as ErrRequestBodyTooLarge returned with MaxBodySize, are returned as they are.
+func BindJSON(r *http.Request, dest interface{}) error {
+	t, err := bindType(dest)
+	if err != nil {
+		return err
+	}
+
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+
+	err = json.Unmarshal(b, dest)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidBody, err)
+	}
+
+	var present map[string]json.RawMessage
+	if json.Unmarshal(b, &present) != nil {
+		present = nil
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() || field.Tag.Get("bind") != "required" {
+			continue
+		}
+
+		name := jsonFieldName(field)
+		if name == "-" {
+			continue
+		}
+
+		v, ok := lookupJSONField(present, name)
+		if !ok || bytes.Equal(bytes.TrimSpace(v), []byte("null")) {
+			return fmt.Errorf("%w: %s", ErrMissingField, name)
+		}
+	}
+
+	return nil
+}
+
+// BindForm parses the form of the request, including the query, with r.ParseForm,
+// or r.ParseMultipartForm for multipart forms, and copies the values into the fields of the struct pointed to by dest.
+// The name of a value is specified by the tag "form" of a field, e.g. `form:"email"`,
+// or is the name of the field if there is no tag. Fields with the tag `form:"-"` are skipped.
+// Fields with the tag `bind:"required"` must have a non-empty value.
+//
+// The values are converted as by Params.Scan; slices of such types get all values with the name.
+// It returns an error wrapping ErrInvalidBody if the form cannot be parsed or a value cannot be converted,
+// or ErrMissingField naming the first missing field.
+func BindForm(r *http.Request, dest interface{}) error {
+	t, err := bindType(dest)
+	if err != nil {
+		return err
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		err = r.ParseMultipartForm(maxFormMemory)
+	} else {
+		err = r.ParseForm()
+	}
+	if err != nil {
+		if errors.Is(err, ErrRequestBodyTooLarge) {
+			return err
+		}
+		return fmt.Errorf("%w: %s", ErrInvalidBody, err)
+	}
+
+	v := reflect.ValueOf(dest).Elem()
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name := field.Tag.Get("form")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		values := r.Form[name]
+		if field.Tag.Get("bind") == "required" && (len(values) == 0 || values[0] == "") {
+			return fmt.Errorf("%w: %s", ErrMissingField, name)
+		}
+		if len(values) == 0 {
+			continue
+		}
+
+		err := setFormValue(v.Field(i), values)
+		if err != nil {
+			return fmt.Errorf("%w: field %s: %s", ErrInvalidBody, name, err)
+		}
+	}
+
+	return nil
+}
+
+func bindType(dest interface{}) (reflect.Type, error) {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%w: %T is not a pointer to a struct", ErrInvalidDestination, dest)
+	}
+	return v.Elem().Type(), nil
+}
+
+// setFormValue stores the values in v, which is a slice or a type supported by setValue.
+func setFormValue(v reflect.Value, values []string) error {
+	if v.Kind() != reflect.Slice {
+		return setValue(v, values[0])
+	}
+
+	a := reflect.MakeSlice(v.Type(), len(values), len(values))
+	for i, s := range values {
+		err := setValue(a.Index(i), s)
+		if err != nil {
+			return err
+		}
+	}
+	v.Set(a)
+	return nil
+}
+
+func jsonFieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+// lookupJSONField returns the value of a key of a JSON object,
+// matching the key case-insensitively if there is no exact match, as encoding/json does.
+func lookupJSONField(m map[string]json.RawMessage, name string) (json.RawMessage, bool) {
+	if v, ok := m[name]; ok {
+		return v, true
+	}
+	for k, v := range m {
+		if strings.EqualFold(k, name) {
+			return v, true
+		}
+	}
+	return nil, false
+}
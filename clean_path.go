@@ -0,0 +1,59 @@
+package router
+
+import (
+	"net/http"
+	"path"
+	"strings"
+)
+
+// CleanPath returns a middleware function that cleans the path of requests with path.Clean,
+// collapsing repeated slashes and resolving "." and ".." segments. A trailing slash is kept.
+// It should be added with UseGlobal, so that the path is cleaned before routing.
+//
+// If the path changes, the request is redirected to the clean path with the status code,
+// such as http.StatusMovedPermanently, or, if the code is zero, the path is rewritten in place,
+// so the request is routed by the clean path without a redirect visible to the client.
+//
+// Rewriting should be used with care behind proxies or other middleware that check access by the path:
+// they see the original path, e.g. "/public/../admin", while the request is routed to "/admin".
+// Redirecting makes the client request the clean path, so every layer sees the same one.
+func CleanPath(code int) MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p := cleanPath(r.URL.Path)
+			if p == r.URL.Path {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			u := *r.URL
+			u.Path = p
+			if u.RawPath != "" {
+				// EscapedPath ignores RawPath if it is not a valid encoding of Path.
+				u.RawPath = cleanPath(u.RawPath)
+			}
+
+			if code != 0 {
+				http.Redirect(w, r, u.RequestURI(), code)
+				return
+			}
+
+			r2 := new(http.Request)
+			*r2 = *r
+			r2.URL = &u
+			next.ServeHTTP(w, r2)
+		})
+	}
+}
+
+func cleanPath(p string) string {
+	if p == "" {
+		return "/"
+	}
+
+	clean := path.Clean("/" + p)
+	if strings.HasSuffix(p, "/") && clean != "/" {
+		clean += "/"
+	}
+	return clean
+}
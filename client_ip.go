@@ -0,0 +1,66 @@
+package router
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ClientIP returns the IP address of the client that sent the request.
+//
+// The X-Forwarded-For and X-Real-IP headers are only honored when the request
+// comes from one of the trusted proxies; otherwise they could be spoofed by the client.
+// X-Forwarded-For is read from right to left, skipping the addresses of trusted proxies,
+// so that the first untrusted address is returned.
+// If the forwarding headers are absent or invalid, the address from r.RemoteAddr is returned.
+func ClientIP(r *http.Request, trustedProxies []net.IPNet) string {
+	remoteIP := parseIP(r.RemoteAddr)
+	if remoteIP == nil {
+		return r.RemoteAddr
+	}
+	if !ipTrusted(remoteIP, trustedProxies) {
+		return remoteIP.String()
+	}
+
+	if values := r.Header.Values("X-Forwarded-For"); len(values) > 0 {
+		a := strings.Split(strings.Join(values, ","), ",")
+
+		var ip net.IP
+		for i := len(a) - 1; i >= 0; i-- {
+			ip = parseIP(a[i])
+			if ip == nil {
+				break
+			}
+			if !ipTrusted(ip, trustedProxies) {
+				return ip.String()
+			}
+		}
+		if ip != nil {
+			// All addresses are trusted, the leftmost one is the client.
+			return ip.String()
+		}
+	}
+
+	if ip := parseIP(r.Header.Get("X-Real-IP")); ip != nil {
+		return ip.String()
+	}
+
+	return remoteIP.String()
+}
+
+func parseIP(s string) net.IP {
+	s = strings.TrimSpace(s)
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	return net.ParseIP(s)
+}
+
+func ipTrusted(ip net.IP, trustedProxies []net.IPNet) bool {
+	for _, n := range trustedProxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Concurrency returns a middleware function that limits the number of requests
+// handled simultaneously to n, e.g. to protect an expensive handler.
+//
+// When the limit is reached, a request waits up to the specified duration for a slot
+// to become free, or until the request is canceled. If wait is zero, the request
+// does not wait at all. Requests that do not get a slot are rejected
+// with the status 503 Service Unavailable.
+//
+// The slot is released when the handler returns or panics,
+// so a panic recovered by the handler set with HandlePanic does not reduce the limit.
+//
+// The middleware function can be added to a group containing the protected routes,
+// or wrap the handler of a single route. Since the limit is shared by all requests
+// passing through the returned function, separate calls create separate limits.
+//
+// Concurrency panics if n is not positive.
+func Concurrency(n int, wait time.Duration) MiddlewareFunc {
+	if n <= 0 {
+		panic(fmt.Sprintf("invalid concurrency limit: %d", n))
+	}
+
+	semaphore := make(chan struct{}, n)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !acquire(semaphore, wait, r) {
+				http.Error(w,
+					http.StatusText(http.StatusServiceUnavailable),
+					http.StatusServiceUnavailable,
+				)
+				return
+			}
+			defer func() {
+				<-semaphore
+			}()
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func acquire(semaphore chan struct{}, wait time.Duration, r *http.Request) bool {
+	select {
+	case semaphore <- struct{}{}:
+		return true
+	default:
+	}
+
+	if wait <= 0 {
+		return false
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case semaphore <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	case <-r.Context().Done():
+		return false
+	}
+}
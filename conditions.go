@@ -1,25 +1,121 @@
 package router
 
 import (
+	"net/http"
+
 	"github.com/julienschmidt/httprouter"
 )
 
-type conditions map[int]func(string) bool
+// condition is a function for validating a parameter.
+// If the function is based on a regular expression, its source is retained for introspection.
+// If onFail is not nil, it handles the request when no other route matches.
+type condition struct {
+	match   func(string) bool
+	pattern string
+	onFail  http.Handler
+}
+
+// and returns a condition matching the values matched by both conditions.
+// It keeps the onFail handler. The source of a regular expression equivalent to both ones is unknown, so it is dropped.
+func (c condition) and(other condition) condition {
+	return condition{
+		match: func(s string) bool {
+			return c.match(s) && other.match(s)
+		},
+		onFail: c.onFail,
+	}
+}
+
+// or returns a condition matching the values matched by either condition.
+// It keeps the onFail handler, and combines the sources of regular expressions, if both are known.
+func (c condition) or(other condition) condition {
+	combined := condition{
+		match: func(s string) bool {
+			return c.match(s) || other.match(s)
+		},
+		onFail: c.onFail,
+	}
+	if c.pattern != "" && other.pattern != "" {
+		combined.pattern = "(?:" + c.pattern + ")|(?:" + other.pattern + ")"
+	}
+	return combined
+}
+
+// conditions holds the conditions of parameters indexed by the position of the parameter.
+// A slice is used instead of a map so that the conditions are always evaluated in the same order.
+type conditions []condition
 
 func (c conditions) clone() conditions {
 	clone := make(conditions, len(c))
-	for k, r := range c {
-		clone[k] = r
+	copy(clone, c)
+	return clone
+}
+
+func (c conditions) get(i int) func(string) bool {
+	if i < len(c) {
+		return c[i].match
+	}
+	return nil
+}
+
+func (c *conditions) set(i int, cond condition) {
+	for len(*c) <= i {
+		*c = append(*c, condition{})
 	}
+	(*c)[i] = cond
+}
+
+// match evaluates the conditions in the order of the parameters in the pattern.
+// If a condition fails, its onFail handler is returned.
+func (c conditions) match(params httprouter.Params) (bool, http.Handler) {
+	i, onFail := c.failed(params)
+	return i < 0, onFail
+}
+
+// failed returns the position of the parameter whose condition fails first, and its onFail handler,
+// or -1 if all conditions match.
+func (c conditions) failed(params httprouter.Params) (int, http.Handler) {
+	for i, cond := range c {
+		if cond.match == nil {
+			continue
+		}
+
+		v := params[i].Value
+		if !cond.match(v) {
+			return i, cond.onFail
+		}
+	}
+	return -1, nil
+}
+
+// requestCondition is a function validating a request as a whole.
+// If onFail is not nil, it handles the request when no other route matches.
+type requestCondition struct {
+	match  func(*http.Request) bool
+	onFail http.Handler
+}
+
+// requestConditions holds the conditions of a request.
+type requestConditions []requestCondition
+
+func (c requestConditions) clone() requestConditions {
+	clone := make(requestConditions, len(c))
+	copy(clone, c)
 	return clone
 }
 
-func (c conditions) match(params httprouter.Params) bool {
-	for k, fn := range c {
-		v := params[k].Value
-		if !fn(v) {
-			return false
+// match evaluates the conditions in the order they have been added.
+// If a condition fails, its onFail handler is returned.
+// A nil request matches any conditions.
+func (c requestConditions) match(r *http.Request) (bool, http.Handler) {
+	if r == nil {
+		return true, nil
+	}
+
+	for _, cond := range c {
+		if !cond.match(r) {
+			return false, cond.onFail
 		}
 	}
-	return true
+	return true, nil
 }
@@ -0,0 +1,116 @@
+package router
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// CORSOptions configures the middleware returned by CORSForRouter.
+type CORSOptions struct {
+	// AllowedOrigins is a list of origins allowed to make cross-origin requests.
+	// The value "*" allows any origin.
+	AllowedOrigins []string
+
+	// AllowedHeaders is a list of request headers allowed in cross-origin requests.
+	// If empty, the headers listed in a preflight request are allowed.
+	AllowedHeaders []string
+
+	// ExposedHeaders is a list of response headers exposed to the client.
+	ExposedHeaders []string
+
+	// AllowCredentials indicates whether requests can include credentials.
+	AllowCredentials bool
+
+	// MaxAge is the number of seconds the results of a preflight request can be cached.
+	MaxAge int
+}
+
+// CORSForRouter returns a middleware function that handles Cross-Origin Resource Sharing.
+//
+// Preflight requests are answered with the methods actually allowed for the requested path,
+// as returned by router.AllowedMethods. Preflight requests for unknown paths are passed through,
+// so they get the usual 404 response.
+//
+// Since preflight requests do not match the routes, the middleware should wrap the router itself
+// rather than be added with Use:
+//
+//	http.ListenAndServe(addr, CORSForRouter(r, opts)(r))
+func CORSForRouter(router *Router, opts CORSOptions) MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h := w.Header()
+			h.Add("Vary", "Origin")
+
+			if !opts.originAllowed(origin) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+			if preflight {
+				methods := router.AllowedMethods(r.URL.Path)
+				if len(methods) == 0 {
+					next.ServeHTTP(w, r)
+					return
+				}
+
+				h.Add("Vary", "Access-Control-Request-Method")
+				h.Add("Vary", "Access-Control-Request-Headers")
+				h.Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+
+				if len(opts.AllowedHeaders) > 0 {
+					h.Set("Access-Control-Allow-Headers", strings.Join(opts.AllowedHeaders, ", "))
+				} else if s := r.Header.Get("Access-Control-Request-Headers"); s != "" {
+					h.Set("Access-Control-Allow-Headers", s)
+				}
+
+				if opts.MaxAge > 0 {
+					h.Set("Access-Control-Max-Age", strconv.Itoa(opts.MaxAge))
+				}
+			} else if len(opts.ExposedHeaders) > 0 {
+				h.Set("Access-Control-Expose-Headers", strings.Join(opts.ExposedHeaders, ", "))
+			}
+
+			if opts.AllowCredentials {
+				h.Set("Access-Control-Allow-Origin", origin)
+				h.Set("Access-Control-Allow-Credentials", "true")
+			} else if opts.anyOrigin() {
+				h.Set("Access-Control-Allow-Origin", "*")
+			} else {
+				h.Set("Access-Control-Allow-Origin", origin)
+			}
+
+			if preflight {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (opts *CORSOptions) originAllowed(origin string) bool {
+	for _, s := range opts.AllowedOrigins {
+		if s == "*" || strings.EqualFold(s, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func (opts *CORSOptions) anyOrigin() bool {
+	for _, s := range opts.AllowedOrigins {
+		if s == "*" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,40 @@
+package router
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// routeStats holds the statistics of a route collected for DebugEndpoint.
+type routeStats struct {
+	requests uint64
+	latency  int64
+}
+
+func (stats *routeStats) add(latency time.Duration) {
+	atomic.AddUint64(&stats.requests, 1)
+	atomic.StoreInt64(&stats.latency, int64(latency))
+}
+
+func (stats *routeStats) get() (uint64, time.Duration) {
+	return atomic.LoadUint64(&stats.requests), time.Duration(atomic.LoadInt64(&stats.latency))
+}
+
+// DebugEndpoint adds a GET route rendering the table of routes as plain text,
+// with the number of requests handled by each route and the latency of the last one.
+//
+// The statistics are only collected after DebugEndpoint has been called, so there is no overhead otherwise.
+// The latency is measured for the handler of the route, excluding the middleware functions.
+// Since the page exposes the structure of the application, the returned route should be protected,
+// e.g. by adding it to a group with authentication middleware, or made internal with SkipMiddleware
+// and served on a separate listener.
+func (router *Router) DebugEndpoint(path string) *Route {
+	atomic.StoreInt32(&router.global.profiling, 1)
+
+	return router.Get(path).HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		router.printRoutes(w, true)
+	})
+}
@@ -0,0 +1,133 @@
+package router
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// DryRunResult describes how the router would handle a request, as reported by DryRun.
+type DryRunResult struct {
+	// Route is the matched route, or nil if there is none.
+	Route *Route
+	// Name and Pattern are the name and the pattern of the matched route, if any.
+	Name    string
+	Pattern string
+	// Params are the named parameters the handler would get, after transforms.
+	Params Params
+	// GlobalMiddleware is the number of middleware functions added with UseGlobal, which run for any request.
+	GlobalMiddleware int
+	// Middleware is the number of middleware functions that would wrap the handler, as counted by Route.MiddlewareCount.
+	Middleware int
+	// Status is 200 if a route matches, or the status of the response of the router otherwise,
+	// such as 404, 405, or 301 and 307 for a redirect to the path with or without a trailing slash.
+	// It is zero if Rejected is true.
+	Status int
+	// Location is the target of a redirect.
+	Location string
+	// Rejected reports whether no route matches, and the request would be handled by the handler
+	// of a failed condition instead, such as the ones set with WhereElse or Consumes.
+	Rejected bool
+}
+
+// DryRun reports how the router would handle a request with the method, the path and the headers,
+// without calling any handlers or middleware functions. The path can contain a query string,
+// and the Host header is used as the host of the request.
+//
+// Unlike AllowedMethods, it evaluates the conditions of requests, such as the ones set with WhereHeader,
+// WhereQuery or Consumes, so it can be used to verify conditional routing in tests or to analyze recorded traffic.
+// The limit set with MaxPathLength and AutoHead are taken into account;
+// the effects of middleware functions, e.g. rewriting the path, as well as the redirects of fixed paths, are not.
+func (router *Router) DryRun(method string, path string, headers http.Header) DryRunResult {
+	result := DryRunResult{
+		GlobalMiddleware: len(router.global.middleware),
+	}
+
+	u, err := url.ParseRequestURI(path)
+	if err != nil {
+		result.Status = http.StatusBadRequest
+		return result
+	}
+
+	if headers == nil {
+		headers = make(http.Header)
+	}
+	r := &http.Request{
+		Method: method,
+		URL:    u,
+		Header: headers,
+		Host:   headers.Get("Host"),
+	}
+
+	if n := router.global.maxPathLength; n > 0 && len(u.EscapedPath()) > n {
+		result.Status = http.StatusRequestURITooLong
+		return result
+	}
+
+	if method == http.MethodHead && router.global.autoHead {
+		if routes, _ := router.lookup(http.MethodHead, u.Path); routes == nil {
+			if routes, _ := router.lookup(http.MethodGet, u.Path); routes != nil {
+				method = http.MethodGet
+			}
+		}
+	}
+
+	if handle, _, _ := router.r.Lookup(method, u.Path); handle != nil {
+		if routes, params := router.lookup(method, u.Path); routes != nil {
+			result.match(routes, params, r)
+			return result
+		}
+	}
+
+	if location, code := router.trailingSlashRedirect(method, u); code != 0 {
+		result.Status = code
+		result.Location = location
+		return result
+	}
+
+	options := method == http.MethodOptions && router.r.HandleOPTIONS
+	if !options {
+		// The routes with catch-all parameters matched by the router are tried by the NotFound
+		// and MethodNotAllowed handlers.
+		if routes, params := router.lookup(method, u.Path); routes != nil {
+			result.match(routes, params, r)
+			return result
+		}
+	}
+	if options || router.r.HandleMethodNotAllowed {
+		for m := range router.routes {
+			if m == method || m == http.MethodOptions {
+				continue
+			}
+			if handle, _, _ := router.r.Lookup(m, u.Path); handle != nil {
+				result.Status = http.StatusMethodNotAllowed
+				if options {
+					result.Status = http.StatusOK
+				}
+				return result
+			}
+		}
+	}
+
+	result.Status = http.StatusNotFound
+	return result
+}
+
+// match sets the result for the routes registered for the path.
+func (result *DryRunResult) match(routes *routeList, params httprouter.Params, r *http.Request) {
+	route, params, rejected := routes.match(params, r)
+	switch {
+	case route != nil:
+		result.Route = route
+		result.Name = route.name
+		result.Pattern = string(route.pattern)
+		result.Params = route.namedParams(params)
+		result.Middleware = route.MiddlewareCount()
+		result.Status = http.StatusOK
+	case rejected != nil:
+		result.Rejected = true
+	default:
+		result.Status = http.StatusNotFound
+	}
+}
@@ -7,5 +7,17 @@ import (
 var (
 	ErrRouteNotFound       = errors.New("route not found")
 	ErrNotEnoughParameters = errors.New("not enough parameters")
+	ErrTooManyParameters   = errors.New("too many parameters")
 	ErrInvalidParameter    = errors.New("invalid parameter")
+	ErrRequestBodyTooLarge = errors.New("request body too large")
+	ErrHijackNotSupported  = errors.New("hijacking not supported")
+	ErrInvalidDestination  = errors.New("invalid destination")
+	ErrInvalidBody         = errors.New("invalid request body")
+	ErrMissingField        = errors.New("missing required field")
+	ErrNoHandler           = errors.New("no handler")
+	ErrDuplicateName       = errors.New("duplicate route name")
+	ErrShadowedRoute       = errors.New("route is shadowed")
+	ErrMissingCondition    = errors.New("parameter has no conditions")
+	ErrMissingHandler      = errors.New("missing handler")
+	ErrMissingMiddleware   = errors.New("missing middleware")
 )
@@ -0,0 +1,160 @@
+package router
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ETag returns a middleware function that sets a strong ETag for responses to GET requests,
+// and responds with 304 Not Modified when the ETag matches the If-None-Match header of the request.
+// Responses to HEAD requests have no body to compute the ETag from, so they are passed through,
+// keeping only an ETag set by the handler, rather than getting a validator different from the one of GET.
+//
+// The ETag is computed from the response body, so the body is buffered.
+// Responses larger than maxBufferSize bytes, responses with statuses other than 200 OK,
+// and responses flushed by the handler are passed through without an ETag.
+// The connection can be hijacked, e.g. by websocket handlers, in which case nothing is written.
+// If the handler sets the ETag header itself, that value is used instead of the computed one.
+func ETag(maxBufferSize int) MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ew := &etagWriter{
+				ResponseWriter: w,
+				maxBufferSize:  maxBufferSize,
+			}
+			next.ServeHTTP(ew, r)
+			ew.finish(r)
+		})
+	}
+}
+
+type etagWriter struct {
+	http.ResponseWriter
+	maxBufferSize int
+	buf           bytes.Buffer
+	status        int
+	passthrough   bool
+}
+
+func (ew *etagWriter) WriteHeader(status int) {
+	if ew.status != 0 {
+		return
+	}
+
+	ew.status = status
+	if ew.passthrough {
+		ew.ResponseWriter.WriteHeader(status)
+	}
+}
+
+func (ew *etagWriter) Write(b []byte) (int, error) {
+	if ew.status == 0 {
+		ew.status = http.StatusOK
+	}
+
+	if !ew.passthrough && (ew.status != http.StatusOK || ew.buf.Len()+len(b) > ew.maxBufferSize) {
+		ew.startPassthrough()
+	}
+	if ew.passthrough {
+		return ew.ResponseWriter.Write(b)
+	}
+
+	return ew.buf.Write(b)
+}
+
+func (ew *etagWriter) Flush() {
+	if !ew.passthrough {
+		if ew.status == 0 {
+			ew.status = http.StatusOK
+		}
+		ew.startPassthrough()
+	}
+
+	if f, ok := ew.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack implements the http.Hijacker interface.
+// It returns ErrHijackNotSupported if the underlying writer does not support hijacking.
+func (ew *etagWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := ew.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, ErrHijackNotSupported
+	}
+
+	conn, rw, err := h.Hijack()
+	if err == nil {
+		ew.passthrough = true
+		ew.buf.Reset()
+	}
+	return conn, rw, err
+}
+
+// Unwrap returns the underlying writer. It is used by http.ResponseController.
+func (ew *etagWriter) Unwrap() http.ResponseWriter {
+	return ew.ResponseWriter
+}
+
+func (ew *etagWriter) startPassthrough() {
+	ew.passthrough = true
+	ew.ResponseWriter.WriteHeader(ew.status)
+	ew.ResponseWriter.Write(ew.buf.Bytes())
+	ew.buf.Reset()
+}
+
+func (ew *etagWriter) finish(r *http.Request) {
+	if ew.passthrough {
+		return
+	}
+	if ew.status == 0 {
+		ew.status = http.StatusOK
+	}
+
+	h := ew.Header()
+	if ew.status == http.StatusOK {
+		etag := h.Get("ETag")
+		if etag == "" {
+			sum := sha256.Sum256(ew.buf.Bytes())
+			etag = `"` + hex.EncodeToString(sum[:16]) + `"`
+			h.Set("ETag", etag)
+		}
+
+		if etagMatch(r.Header.Get("If-None-Match"), etag) {
+			h.Del("Content-Type")
+			h.Del("Content-Length")
+			ew.ResponseWriter.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	ew.ResponseWriter.WriteHeader(ew.status)
+	ew.ResponseWriter.Write(ew.buf.Bytes())
+}
+
+// etagMatch reports whether the value of the If-None-Match header matches the ETag,
+// using the weak comparison.
+func etagMatch(ifNoneMatch string, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, s := range strings.Split(ifNoneMatch, ",") {
+		s = strings.TrimSpace(s)
+		if s == "*" || strings.TrimPrefix(s, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+package router
+
+import (
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+)
+
+var fileRouteParamRegexp = regexp.MustCompile(`\[(\.\.\.)?([^\[\]]+)\]`)
+
+// FileRoutes walks the directory and adds a route for each file,
+// with the pattern derived from the path of the file relative to the directory.
+// The handler of a route is returned by handlerFor, which receives the relative path
+// with forward slashes, e.g. "articles/[id].go"; files for which it returns nil are skipped.
+// The routes handle all standard methods, as with Handle, so handlers should check the method if needed.
+//
+// The path of a file is mapped to a pattern according to the following rules:
+//   - the extension of the file is removed: "about.html" becomes "/about";
+//   - a file named "index" represents its directory: "articles/index.go" becomes "/articles";
+//   - a name in brackets becomes a parameter: "articles/[id].go" becomes "/articles/{id}",
+//     and "[id].[format].go" becomes "/{id}.{format}";
+//   - a name in brackets with a leading ellipsis becomes a catch-all parameter:
+//     "files/[...path].go" becomes "/files/{path...}";
+//   - files and directories whose names start with "." or "_" are skipped.
+//
+// The files are visited in lexical order. Since httprouter does not allow a parameter
+// next to a static segment, a directory cannot contain both "new.go" and "[id].go":
+// such a conflict is returned as an error naming the file, keeping the routes added before it.
+func (router *Router) FileRoutes(dir string, handlerFor func(relpath string) http.Handler) error {
+	return fs.WalkDir(os.DirFS(dir), ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		name := d.Name()
+		if p != "." && (strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		handler := handlerFor(p)
+		if handler == nil {
+			return nil
+		}
+
+		if err := router.tryHandle(fileRoutePattern(p), handler); err != nil {
+			return fmt.Errorf("%s: %w", p, err)
+		}
+		return nil
+	})
+}
+
+// tryHandle adds a route with the handler for all standard methods,
+// and returns the panic caused by a conflict with other routes as an error.
+func (router *Router) tryHandle(pattern string, handler http.Handler) (err error) {
+	defer func() {
+		if rcv := recover(); rcv != nil {
+			err = fmt.Errorf("%v", rcv)
+		}
+	}()
+
+	router.NewRoute(pattern, standardMethods...).Handle(handler)
+	return nil
+}
+
+// fileRoutePattern converts the relative path of a file to the pattern of a route.
+func fileRoutePattern(p string) string {
+	p = strings.TrimSuffix(p, path.Ext(p))
+
+	if path.Base(p) == "index" {
+		p = path.Dir(p)
+		if p == "." {
+			p = ""
+		}
+	}
+
+	return "/" + fileRouteParamRegexp.ReplaceAllString(p, "{$2$1}")
+}
@@ -0,0 +1,296 @@
+package router
+
+import (
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// globalHandler holds the middleware functions wrapping the entire router, and the panic handlers.
+// It is shared by the router and its groups.
+type globalHandler struct {
+	middleware       middlewareList
+	timeout          time.Duration
+	maxPathLength    int
+	autoHead         bool
+	onTrailingSlash  func(from, to string)
+	strictUrl        bool
+	versionMediaType string
+	skipping         bool
+	profiling        int32
+	handler          http.Handler
+	panicHandlers    []func(http.ResponseWriter, *http.Request, interface{})
+	errorRenderer    func(http.ResponseWriter, *http.Request, error)
+	errorStatuses    []errorStatus
+	invalidRequest   func(http.ResponseWriter, *http.Request, error)
+	dispatching      bool
+	r                *httprouter.Router
+	notFound         http.Handler
+	notFoundRaw      http.Handler
+	notAllowed       http.Handler
+	subtrees         []subtreeHandler
+	prefixes         []prefixMiddleware
+	prefixed         bool
+	wildcards        []wildcardHandler
+	shutdownHooks    []func()
+	tagMiddleware    []tagMiddleware
+}
+
+// clone returns a copy of the global handler for Router.DeepClone.
+// The handlers of the wildcards and the handler wrapping httprouter are not copied,
+// since they refer to the routes of the original router, and are built again by DeepClone.
+func (global *globalHandler) clone() *globalHandler {
+	clone := *global
+	clone.middleware = global.middleware.clone()
+	clone.profiling = atomic.LoadInt32(&global.profiling)
+	clone.handler = nil
+	clone.panicHandlers = append(clone.panicHandlers[:0:0], global.panicHandlers...)
+	clone.errorStatuses = append(clone.errorStatuses[:0:0], global.errorStatuses...)
+	clone.subtrees = append(clone.subtrees[:0:0], global.subtrees...)
+	clone.prefixes = append(clone.prefixes[:0:0], global.prefixes...)
+	clone.wildcards = nil
+	clone.shutdownHooks = append(clone.shutdownHooks[:0:0], global.shutdownHooks...)
+	clone.tagMiddleware = append(clone.tagMiddleware[:0:0], global.tagMiddleware...)
+	return &clone
+}
+
+// subtreeHandler is a handler set with NotFoundHere for the paths starting with a prefix.
+type subtreeHandler struct {
+	prefix  *regexp.Regexp
+	depth   int
+	handler http.Handler
+}
+
+// prefixMiddleware is the middleware of a group created with Prefix,
+// used for the paths starting with the prefix if NotFoundWithPrefixMiddleware is enabled.
+// The prefix is compiled by sortPrefixes, so that the groups cost nothing while the option is disabled.
+type prefixMiddleware struct {
+	pattern    pattern
+	prefix     *regexp.Regexp
+	depth      int
+	middleware middlewareList
+}
+
+// sortPrefixes compiles the prefixes recorded by Prefix, and sorts them from the deepest one.
+func (global *globalHandler) sortPrefixes() {
+	for i := range global.prefixes {
+		if p := &global.prefixes[i]; p.prefix == nil {
+			p.prefix = p.pattern.prefixRegexp()
+			p.depth = strings.Count(string(p.pattern.routePattern()), "/")
+		}
+	}
+
+	sort.SliceStable(global.prefixes, func(i, j int) bool {
+		return global.prefixes[i].depth > global.prefixes[j].depth
+	})
+}
+
+func (global *globalHandler) handlePanic(w http.ResponseWriter, r *http.Request, rcv interface{}) {
+	for _, handler := range global.panicHandlers {
+		handler(w, r, rcv)
+	}
+}
+
+// installDispatch replaces the NotFound and MethodNotAllowed handlers of httprouter
+// with serveNotFound and serveMethodNotAllowed.
+func (global *globalHandler) installDispatch(r *httprouter.Router) {
+	if global.dispatching {
+		return
+	}
+
+	global.dispatching = true
+	global.r = r
+	global.notFound = r.NotFound
+	global.notAllowed = r.MethodNotAllowed
+	r.NotFound = http.HandlerFunc(global.serveNotFound)
+	r.MethodNotAllowed = http.HandlerFunc(global.serveMethodNotAllowed)
+}
+
+// serveMethodNotAllowed calls the handler of the routes with catch-all parameters matched by the router, if any,
+// since httprouter only finds the routes of other methods, or the handler set with HandleMethodNotAllowed.
+// The methods of such routes matching the path are added to the Allow header set by httprouter.
+func (global *globalHandler) serveMethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	// The Allow header set by httprouter is removed if the request is handled by a route.
+	allow := w.Header().Get("Allow")
+	w.Header().Del("Allow")
+	if global.serveWildcard(w, r, r.Method) {
+		return
+	}
+
+	methods := global.wildcardMethods(r.URL.Path, r.Method)
+	if allow != "" {
+		for _, method := range strings.Split(allow, ", ") {
+			if !hasMethod(methods, method) {
+				methods = append(methods, method)
+			}
+		}
+	}
+	if len(methods) > 0 {
+		w.Header().Set("Allow", allowHeader(methods))
+	}
+
+	global.methodNotAllowed(w, r)
+}
+
+// methodNotAllowed calls the handler set with HandleMethodNotAllowed,
+// or responds with 405 Method Not Allowed if there is none.
+func (global *globalHandler) methodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	if global.notAllowed != nil {
+		global.notAllowed.ServeHTTP(w, r)
+		return
+	}
+
+	http.Error(w,
+		http.StatusText(http.StatusMethodNotAllowed),
+		http.StatusMethodNotAllowed,
+	)
+}
+
+// serveNotFound calls the handler of the routes with catch-all parameters matched by the router, if any,
+// the handler of the deepest subtree containing the path,
+// or the handler set with HandleNotFound if there is none.
+// With NotFoundWithPrefixMiddleware, the latter is wrapped in the middleware of the deepest prefix containing the path.
+//
+// Since httprouter does not know the routes with catch-all parameters moved out of it,
+// the requests matched by them are redirected to the path with or without a trailing slash,
+// and get 405 Method Not Allowed for the other methods, as httprouter would do.
+func (global *globalHandler) serveNotFound(w http.ResponseWriter, r *http.Request) {
+	if global.serveWildcard(w, r, r.Method) {
+		return
+	}
+
+	if len(global.wildcards) > 0 {
+		if location, code := global.trailingSlashRedirect(global.r, r.Method, r.URL); code != 0 {
+			http.Redirect(w, r, location, code)
+			return
+		}
+
+		if methods := global.wildcardMethods(r.URL.Path, r.Method); len(methods) > 0 {
+			if r.Method == http.MethodOptions && global.r.HandleOPTIONS {
+				w.Header().Set("Allow", allowHeader(methods))
+				if global.r.GlobalOPTIONS != nil {
+					global.r.GlobalOPTIONS.ServeHTTP(w, r)
+				}
+				return
+			}
+			if r.Method != http.MethodOptions && global.r.HandleMethodNotAllowed {
+				w.Header().Set("Allow", allowHeader(methods))
+				global.methodNotAllowed(w, r)
+				return
+			}
+		}
+	}
+
+	for _, subtree := range global.subtrees {
+		if subtree.prefix.MatchString(r.URL.Path) {
+			subtree.handler.ServeHTTP(w, r)
+			return
+		}
+	}
+
+	if global.prefixed {
+		for _, prefix := range global.prefixes {
+			if prefix.prefix.MatchString(r.URL.Path) {
+				handler := global.notFoundRaw
+				if handler == nil {
+					handler = http.NotFoundHandler()
+				}
+				prefix.middleware.wrap(handler).ServeHTTP(w, r)
+				return
+			}
+		}
+	}
+
+	global.notFound.ServeHTTP(w, r)
+}
+
+// SetTimeout sets a time limit for handling every request, using http.TimeoutHandler.
+// When the limit is exceeded, the client receives 503 Service Unavailable.
+// A zero duration removes the limit.
+//
+// The limit wraps the router like the middleware added with UseGlobal, inside them.
+// Since the writer passed to handlers by http.TimeoutHandler does not implement
+// http.Flusher and http.Hijacker, streaming and websocket routes should opt out
+// with Route.SkipMiddleware. Handlers should also respect the cancellation
+// of the request context, since they are not stopped when the limit is exceeded.
+func (router *Router) SetTimeout(d time.Duration) {
+	router.global.timeout = d
+	router.buildGlobalHandler()
+}
+
+// MaxPathLength sets the maximum length of the escaped path of a request.
+// Requests with longer paths are rejected with 414 Request URI Too Long before routing,
+// and before the middleware functions added with UseGlobal.
+// Zero, the default, means no limit.
+func (router *Router) MaxPathLength(n int) {
+	router.global.maxPathLength = n
+	router.buildGlobalHandler()
+}
+
+func (router *Router) buildGlobalHandler() {
+	global := router.global
+
+	if len(global.middleware) == 0 && global.timeout <= 0 && global.maxPathLength <= 0 && !global.autoHead &&
+		global.onTrailingSlash == nil {
+		global.handler = nil
+		return
+	}
+
+	var handler http.Handler = router.r
+	if global.onTrailingSlash != nil {
+		handler = router.trailingSlashHandler(handler)
+	}
+	if global.autoHead {
+		handler = router.headHandler(handler)
+	}
+	if global.timeout > 0 {
+		handler = router.timeoutHandler(handler, global.timeout)
+	}
+
+	handler = global.middleware.wrap(handler)
+
+	if global.maxPathLength > 0 {
+		handler = maxPathLengthHandler(handler, global.maxPathLength)
+	}
+
+	global.handler = handler
+}
+
+func maxPathLengthHandler(next http.Handler, n int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.URL.EscapedPath()) > n {
+			http.Error(w,
+				http.StatusText(http.StatusRequestURITooLong),
+				http.StatusRequestURITooLong,
+			)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (router *Router) timeoutHandler(next http.Handler, d time.Duration) http.Handler {
+	timeout := http.TimeoutHandler(next, d, "")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if router.global.skipping {
+			// The result of matching is carried to the handler of the routes, so they are matched once.
+			if routes, params := router.lookup(r.Method, r.URL.Path); routes != nil && routes.skipsMiddleware() {
+				m := routes.resolve(params, r)
+				r = withMatch(r, m)
+				if m.route != nil && m.route.skipMiddleware {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+		}
+
+		timeout.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,86 @@
+package router
+
+import (
+	"errors"
+	"net/http"
+)
+
+// HandlerE is a handler function that returns an error instead of writing it to the response.
+type HandlerE func(http.ResponseWriter, *http.Request) error
+
+// HandleE sets a handler function returning an error.
+// A non-nil error is passed to the renderer set with Router.SetErrorRenderer,
+// so the handlers do not have to write the error responses themselves.
+// The handler should not write to the response before returning an error.
+func (route *Route) HandleE(h HandlerE) *Route {
+	global := route.router.global
+
+	return route.HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := h(w, r); err != nil {
+			global.renderError(w, r, err)
+		}
+	})
+}
+
+// SetErrorRenderer sets a function writing the responses for the errors returned by the handlers set with HandleE,
+// e.g. mapping the errors to status codes, and rendering them as JSON or HTML.
+// By default, and if fn is nil, the response is written with http.Error, with the status returned by ErrorStatus
+// and its status text rather than the message of the error, so internal details are not exposed to clients.
+func (router *Router) SetErrorRenderer(fn func(w http.ResponseWriter, r *http.Request, err error)) {
+	router.global.errorRenderer = fn
+}
+
+// errorStatus is a status code mapped to an error with MapError.
+type errorStatus struct {
+	target error
+	status int
+}
+
+// MapError maps the errors matching the target, as reported by errors.Is, to the status code,
+// e.g. a domain ErrNotFound to 404 Not Found, so that the errors returned by the handlers set with HandleE
+// are rendered with the status. It works for the errors wrapping the target as well.
+//
+// The mappings are checked in the order they have been added, and the first matching one is used,
+// so more specific errors, e.g. wrapping others, should be mapped first.
+// Mapping the same target again replaces its status, keeping its position.
+func (router *Router) MapError(target error, status int) {
+	global := router.global
+	for i, m := range global.errorStatuses {
+		if m.target == target {
+			global.errorStatuses[i].status = status
+			return
+		}
+	}
+	global.errorStatuses = append(global.errorStatuses, errorStatus{target: target, status: status})
+}
+
+// ErrorStatus returns the status code mapped to the error with MapError,
+// or, if there is none, the status of a StatusError found in the chain of errors,
+// or 500 Internal Server Error otherwise, e.g. for a renderer set with SetErrorRenderer.
+func (router *Router) ErrorStatus(err error) int {
+	return router.global.errorStatus(err)
+}
+
+func (global *globalHandler) errorStatus(err error) int {
+	for _, m := range global.errorStatuses {
+		if errors.Is(err, m.target) {
+			return m.status
+		}
+	}
+
+	var e *StatusError
+	if errors.As(err, &e) {
+		return e.Status
+	}
+	return http.StatusInternalServerError
+}
+
+func (global *globalHandler) renderError(w http.ResponseWriter, r *http.Request, err error) {
+	if global.errorRenderer != nil {
+		global.errorRenderer(w, r, err)
+		return
+	}
+
+	status := global.errorStatus(err)
+	http.Error(w, http.StatusText(status), status)
+}
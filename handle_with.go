@@ -0,0 +1,66 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+)
+
+var (
+	responseWriterType = reflect.TypeOf((*http.ResponseWriter)(nil)).Elem()
+	requestType        = reflect.TypeOf((*http.Request)(nil))
+)
+
+// HandleWith sets a handler function receiving the named parameters of the route as arguments,
+// such as func(w http.ResponseWriter, r *http.Request, userID int, slug string).
+//
+// The arguments following the request are mapped to the parameters in the order
+// they appear in the pattern, and converted to the types of the arguments as in Params.Scan.
+// The function may take fewer arguments than there are parameters.
+// If a parameter cannot be converted, the request is rejected with the status 400 Bad Request.
+//
+// It panics if fn is not a function of this form, or if an argument has an unsupported type.
+func (route *Route) HandleWith(fn interface{}) *Route {
+	v := reflect.ValueOf(fn)
+	t := v.Type()
+
+	if t.Kind() != reflect.Func || t.NumIn() < 2 || t.NumOut() > 0 ||
+		t.In(0) != responseWriterType || t.In(1) != requestType {
+		panic(fmt.Sprintf("invalid handler: %s", t))
+	}
+
+	n := t.NumIn() - 2
+	if n > len(route.paramNames) {
+		panic(fmt.Sprintf("invalid handler: %s has %d parameters", route.pattern, len(route.paramNames)))
+	}
+
+	for i := 0; i < n; i++ {
+		if !canSetValue(t.In(i + 2)) {
+			panic(fmt.Sprintf("invalid handler: unsupported type: %s", t.In(i+2)))
+		}
+	}
+
+	names := route.paramNames[:n]
+
+	return route.HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+		params := ParamsFromRequest(r)
+
+		args := make([]reflect.Value, t.NumIn())
+		args[0] = reflect.ValueOf(w)
+		args[1] = reflect.ValueOf(r)
+
+		for i, name := range names {
+			arg := reflect.New(t.In(i + 2)).Elem()
+
+			s, _ := params.lookup(name)
+			if err := setValue(arg, s); err != nil {
+				http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+				return
+			}
+
+			args[i+2] = arg
+		}
+
+		v.Call(args)
+	})
+}
@@ -0,0 +1,49 @@
+package router
+
+import (
+	"net/http"
+)
+
+// AutoHead sets whether HEAD requests are handled by the GET routes, if there is no HEAD route for the path.
+// The handlers see the HEAD method, and the server discards the body of the response.
+// With AutoHead, HEAD is also reported along with GET by AllowedMethods, PrintRoutes and MarshalRoutes.
+// Url does not depend on the methods, so it works the same for the GET routes.
+func (router *Router) AutoHead(enabled bool) {
+	router.global.autoHead = enabled
+	router.buildGlobalHandler()
+}
+
+// headHandler serves HEAD requests with the GET routes, if there is no HEAD route for the path.
+func (router *Router) headHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if routes, _ := router.lookup(http.MethodHead, r.URL.Path); routes != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if handle, params, _ := router.r.Lookup(http.MethodGet, r.URL.Path); handle != nil {
+			handle(w, r, params)
+			return
+		}
+
+		if router.global.serveWildcard(w, r, http.MethodGet) {
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func hasMethod(methods []string, method string) bool {
+	for _, m := range methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,35 @@
+package router
+
+import (
+	"net/http"
+)
+
+// Health adds a GET route for health or readiness probes.
+// The route responds with 200 OK if check returns nil, and with 503 Service Unavailable otherwise,
+// with a JSON body such as {"status":"ok"} or {"status":"unavailable","error":"..."}.
+// A nil check always reports the service as healthy.
+//
+// The route skips the middleware functions added with Use, as with Route.SkipMiddleware,
+// so that authentication or logging do not interfere with the probes.
+func (router *Router) Health(path string, check func() error) *Route {
+	return router.Get(path).SkipMiddleware().HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+
+		if check != nil {
+			if err := check(); err != nil {
+				writeJSON(w, http.StatusServiceUnavailable, healthJSON{
+					Status: "unavailable",
+					Error:  err.Error(),
+				})
+				return
+			}
+		}
+
+		writeJSON(w, http.StatusOK, healthJSON{Status: "ok"})
+	})
+}
+
+type healthJSON struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
@@ -21,3 +21,14 @@ func (slice Slice[T]) Map(f func(T) T) Slice[T] {
 
 	return a
 }
+
+func (slice Slice[T]) Remove(value T) Slice[T] {
+	a := make(Slice[T], 0, len(slice))
+	for _, v := range slice {
+		if v != value {
+			a = append(a, v)
+		}
+	}
+
+	return a
+}
@@ -0,0 +1,43 @@
+package router
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// RequireHTTPS returns a middleware function that redirects requests received over plain HTTP
+// to the same host and request URI with the https scheme, using the status code, such as http.StatusMovedPermanently.
+// http.StatusPermanentRedirect preserves the method and the body of requests other than GET.
+//
+// A request is considered secure if it has been received over TLS,
+// or if it comes from one of the trusted proxies and its X-Forwarded-Proto header is "https".
+// The header is ignored for other clients, since they could spoof it.
+// The middleware function can be added with UseGlobal to enforce HTTPS for all requests,
+// including unmatched ones.
+func RequireHTTPS(code int, trustedProxies []net.IPNet) MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if requestSecure(r, trustedProxies) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			http.Redirect(w, r, "https://"+r.Host+r.URL.RequestURI(), code)
+		})
+	}
+}
+
+func requestSecure(r *http.Request, trustedProxies []net.IPNet) bool {
+	if r.TLS != nil {
+		return true
+	}
+
+	ip := parseIP(r.RemoteAddr)
+	if ip == nil || !ipTrusted(ip, trustedProxies) {
+		return false
+	}
+
+	proto, _, _ := strings.Cut(r.Header.Get("X-Forwarded-Proto"), ",")
+	return strings.EqualFold(strings.TrimSpace(proto), "https")
+}
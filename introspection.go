@@ -0,0 +1,135 @@
+package router
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Routes returns all routes of the router, sorted by pattern and methods.
+func (router *Router) Routes() []*Route {
+	seen := make(map[*Route]bool)
+	routes := make([]*Route, 0)
+
+	for _, m := range router.routes {
+		for _, a := range m {
+			for _, route := range *a {
+				if !seen[route] {
+					seen[route] = true
+					routes = append(routes, route)
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(routes, func(i, j int) bool {
+		a, b := routes[i], routes[j]
+		if a.pattern != b.pattern {
+			return a.pattern < b.pattern
+		}
+		return routeMethodsKey(a) < routeMethodsKey(b)
+	})
+
+	return routes
+}
+
+// MarshalRoutes returns the table of routes encoded as JSON, e.g. for listing or comparing routes in tools.
+// The result is an array of objects with the following fields:
+//   - "methods": a sorted array of methods, including HEAD for the GET routes with AutoHead;
+//   - "pattern": the pattern of the route;
+//   - "name": the name of the route, omitted if empty;
+//   - "conditions": whether the route has conditions;
+//   - "handler": whether the route has a handler;
+//   - "deprecated": whether the route is deprecated, omitted if false;
+//   - "sunset": the sunset date of a deprecated route in RFC 3339 format, omitted if not set.
+//
+// The routes are sorted by pattern and methods, so the output is stable.
+func (router *Router) MarshalRoutes() ([]byte, error) {
+	routes := router.Routes()
+
+	a := make([]routeJSON, len(routes))
+	for i, route := range routes {
+		a[i] = routeJSON{
+			Methods:    sortedMethods(route),
+			Pattern:    route.Pattern(),
+			Name:       route.GetName(),
+			Conditions: route.HasConditions(),
+			Handler:    route.HasHandler(),
+			Deprecated: route.IsDeprecated(),
+		}
+		if !route.sunset.IsZero() {
+			a[i].Sunset = route.sunset.Format(time.RFC3339)
+		}
+	}
+
+	return json.Marshal(a)
+}
+
+// PrintRoutes writes the table of routes in a human-readable form, e.g. for logging at startup.
+// Each line contains the methods, the pattern, the name, and the number of middleware functions
+// wrapping the route (see Route.MiddlewareCount), in columns aligned with spaces.
+// The routes are sorted by pattern and methods, as in Routes.
+func (router *Router) PrintRoutes(w io.Writer) error {
+	return router.printRoutes(w, false)
+}
+
+// printRoutes writes the table of routes, with the statistics collected for DebugEndpoint if stats is true.
+func (router *Router) printRoutes(w io.Writer, stats bool) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+
+	if stats {
+		fmt.Fprintln(tw, "METHODS\tPATTERN\tNAME\tMIDDLEWARE\tREQUESTS\tLAST LATENCY")
+	} else {
+		fmt.Fprintln(tw, "METHODS\tPATTERN\tNAME\tMIDDLEWARE")
+	}
+
+	for _, route := range router.Routes() {
+		name := route.GetName()
+		if name == "" {
+			name = "-"
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d",
+			strings.Join(sortedMethods(route), ","), route.Pattern(), name, route.MiddlewareCount(),
+		)
+		if stats {
+			requests, latency := route.stats.get()
+			fmt.Fprintf(tw, "\t%d\t%s", requests, latency)
+		}
+		fmt.Fprintln(tw)
+	}
+
+	return tw.Flush()
+}
+
+type routeJSON struct {
+	Methods    []string `json:"methods"`
+	Pattern    string   `json:"pattern"`
+	Name       string   `json:"name,omitempty"`
+	Conditions bool     `json:"conditions"`
+	Handler    bool     `json:"handler"`
+	Deprecated bool     `json:"deprecated,omitempty"`
+	Sunset     string   `json:"sunset,omitempty"`
+}
+
+func sortedMethods(route *Route) []string {
+	methods := route.Methods()
+	if route.router.global.autoHead && !hasMethod(methods, http.MethodHead) && hasMethod(methods, http.MethodGet) {
+		methods = append(methods, http.MethodHead)
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+func routeMethodsKey(route *Route) string {
+	key := ""
+	for _, method := range sortedMethods(route) {
+		key += method + ","
+	}
+	return key
+}
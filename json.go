@@ -0,0 +1,109 @@
+package router
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// StatusError is an error associated with an HTTP status code.
+type StatusError struct {
+	Status int
+	Err    error
+}
+
+// Error implements the error interface.
+func (e *StatusError) Error() string {
+	if e.Err == nil {
+		return http.StatusText(e.Status)
+	}
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *StatusError) Unwrap() error {
+	return e.Err
+}
+
+// SetInvalidRequestHandler sets a function responding to the requests rejected by the functions added with Route.Validate.
+// By default, and if fn is nil, the response is 400 Bad Request with a JSON object {"error": "..."}
+// with the message of the error.
+func (router *Router) SetInvalidRequestHandler(fn func(w http.ResponseWriter, r *http.Request, err error)) {
+	router.global.invalidRequest = fn
+}
+
+func (global *globalHandler) handleInvalidRequest(w http.ResponseWriter, r *http.Request, err error) {
+	if global.invalidRequest != nil {
+		global.invalidRequest(w, r, err)
+		return
+	}
+
+	writeJSONError(w, http.StatusBadRequest, err)
+}
+
+// WrapJSON returns a handler that calls fn and encodes the returned value as JSON.
+//
+// If fn returns an error, the response is a JSON object {"error": "..."}
+// with the status returned by ErrorStatus, i.e. the one mapped to the error with MapError,
+// or the status of a StatusError. For server errors (5xx),
+// the message is the status text, so internal details are not exposed to clients.
+func (router *Router) WrapJSON(fn func(*http.Request) (interface{}, error)) http.Handler {
+	global := router.global
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v, err := fn(r)
+		if err != nil {
+			writeJSONError(w, global.errorStatus(err), err)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, v)
+	})
+}
+
+// JSONNotFound returns a handler that responds with 404 Not Found and the JSON body {"error":"not found"}.
+// It can be passed to HandleNotFound.
+func JSONNotFound() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSONError(w, http.StatusNotFound, errors.New("not found"))
+	})
+}
+
+// JSONMethodNotAllowed returns a handler that responds with 405 Method Not Allowed
+// and the JSON body {"error":"method not allowed"}. It can be passed to HandleMethodNotAllowed.
+func JSONMethodNotAllowed() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSONError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+	})
+}
+
+type jsonError struct {
+	Error string `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	buf := new(bytes.Buffer)
+	err := json.NewEncoder(buf).Encode(v)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+}
+
+func writeJSONError(w http.ResponseWriter, status int, err error) {
+	message := http.StatusText(status)
+	if status < 500 && err != nil {
+		message = err.Error()
+	}
+
+	b, _ := json.Marshal(jsonError{Error: message})
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(append(b, '\n'))
+}
@@ -0,0 +1,133 @@
+package router
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type languageKeyType struct{}
+
+var languageKey = languageKeyType{}
+
+type languageNegotiation struct {
+	supported []string
+	language  string
+}
+
+// AcceptLanguage returns a middleware function that negotiates the language of the response
+// from the Accept-Language header, so that it can be retrieved with LanguageFromRequest.
+//
+// The languages of the header are tried in the order of their quality values ("q").
+// A language matches a supported one if they are equal, ignoring case,
+// or if one of them is a more specific variant of the other, e.g. "en-US" and "en".
+// The wildcard "*" matches the first supported language.
+// If no language of the header is supported, defaultLang is used.
+func AcceptLanguage(supported []string, defaultLang string) MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			language := negotiateLanguage(r.Header.Values("Accept-Language"), supported)
+			if language == "" {
+				language = defaultLang
+			}
+
+			ctx := context.WithValue(r.Context(), languageKey, &languageNegotiation{
+				supported: supported,
+				language:  language,
+			})
+			w.Header().Add("Vary", "Accept-Language")
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// LanguageFromRequest returns the language negotiated by the AcceptLanguage middleware.
+//
+// If the route has the parameter {lang} with one of the supported languages,
+// it takes precedence over the Accept-Language header.
+// An empty string is returned if the middleware has not been used.
+func LanguageFromRequest(r *http.Request) string {
+	negotiation, ok := r.Context().Value(languageKey).(*languageNegotiation)
+	if !ok {
+		return ""
+	}
+
+	if lang, ok := ParamsFromRequest(r).lookup("lang"); ok {
+		for _, s := range negotiation.supported {
+			if strings.EqualFold(s, lang) {
+				return s
+			}
+		}
+	}
+
+	return negotiation.language
+}
+
+type languageRange struct {
+	tag string
+	q   float64
+}
+
+// negotiateLanguage returns the supported language best matching the values of the Accept-Language header,
+// or an empty string if there is none.
+func negotiateLanguage(values []string, supported []string) string {
+	var ranges []languageRange
+	for _, value := range values {
+		for _, s := range strings.Split(value, ",") {
+			tag, params, _ := strings.Cut(s, ";")
+			tag = strings.TrimSpace(tag)
+			if tag == "" {
+				continue
+			}
+
+			q := 1.0
+			for _, param := range strings.Split(params, ";") {
+				k, v, _ := strings.Cut(strings.TrimSpace(param), "=")
+				if k == "q" {
+					if f, err := strconv.ParseFloat(v, 64); err == nil {
+						q = f
+					}
+				}
+			}
+			if q <= 0 {
+				continue
+			}
+
+			ranges = append(ranges, languageRange{tag: tag, q: q})
+		}
+	}
+
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].q > ranges[j].q
+	})
+
+	for _, lr := range ranges {
+		if lr.tag == "*" {
+			if len(supported) > 0 {
+				return supported[0]
+			}
+			continue
+		}
+
+		for _, s := range supported {
+			if strings.EqualFold(s, lr.tag) {
+				return s
+			}
+		}
+		for _, s := range supported {
+			if languageVariant(s, lr.tag) || languageVariant(lr.tag, s) {
+				return s
+			}
+		}
+	}
+
+	return ""
+}
+
+// languageVariant reports whether the language tag a is a more specific variant of b, e.g. "en-US" of "en".
+func languageVariant(a string, b string) bool {
+	return len(a) > len(b) && a[len(b)] == '-' && strings.EqualFold(a[:len(b)], b)
+}
@@ -0,0 +1,57 @@
+package router
+
+import (
+	"net/http"
+	"time"
+)
+
+// LastModified returns a middleware function that sets the Last-Modified header for responses to GET and HEAD requests,
+// and responds with 304 Not Modified without calling the handler when the resource has not been modified
+// since the time in the If-Modified-Since header of the request.
+//
+// The modification time is returned by fn before the handler runs, e.g. from the updated_at column
+// of a database row or the mtime of a file. If fn returns false or a zero time, the request is passed through.
+// The time is truncated to seconds, the precision of the header.
+// Since the named parameters of the path are set after the middleware functions added with Use,
+// fn cannot read them with ParamsFromRequest, and should use the path of the request instead.
+// As required by RFC 9110, If-Modified-Since is ignored for requests with an If-None-Match header,
+// which is left to ETag.
+func LastModified(fn func(*http.Request) (time.Time, bool)) MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			modTime, ok := fn(r)
+			if !ok || modTime.IsZero() {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			modTime = modTime.UTC().Truncate(time.Second)
+			w.Header().Set("Last-Modified", modTime.Format(http.TimeFormat))
+
+			if notModifiedSince(r, modTime) {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// notModifiedSince reports whether the time in the If-Modified-Since header of the request is not older than modTime.
+func notModifiedSince(r *http.Request, modTime time.Time) bool {
+	if r.Header.Get("If-None-Match") != "" {
+		return false
+	}
+
+	t, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	return !modTime.After(t)
+}
@@ -0,0 +1,85 @@
+package router
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// MaxBodySize returns a middleware function that limits the size of request bodies to n bytes.
+//
+// Requests declaring a Content-Length greater than n are rejected
+// with the status 413 Request Entity Too Large before the handler is called.
+// Otherwise the body is wrapped in http.MaxBytesReader, and reading beyond the limit
+// returns an error matching ErrRequestBodyTooLarge, which the handler should respond to
+// with http.StatusRequestEntityTooLarge. The error also wraps the error of http.MaxBytesReader,
+// e.g. *http.MaxBytesError, for errors.As.
+// The same error is returned by r.ParseForm, r.FormValue and similar methods,
+// since they read the body too.
+func MaxBodySize(n int64) MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > n {
+				http.Error(w,
+					http.StatusText(http.StatusRequestEntityTooLarge),
+					http.StatusRequestEntityTooLarge,
+				)
+				return
+			}
+
+			if r.Body != nil && r.Body != http.NoBody {
+				counter := &bodySizeCounter{ReadCloser: r.Body}
+				r.Body = &maxBodySizeReader{
+					ReadCloser: http.MaxBytesReader(w, counter, n),
+					counter:    counter,
+					limit:      n,
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+type bodySizeCounter struct {
+	io.ReadCloser
+	n int64
+}
+
+func (c *bodySizeCounter) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+type maxBodySizeReader struct {
+	io.ReadCloser
+	counter *bodySizeCounter
+	limit   int64
+}
+
+func (r *maxBodySizeReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if err != nil && r.counter.n > r.limit {
+		err = &bodyTooLargeError{err: err, limit: r.limit}
+	}
+	return n, err
+}
+
+// bodyTooLargeError is returned by maxBodySizeReader when the body exceeds the limit.
+type bodyTooLargeError struct {
+	err   error
+	limit int64
+}
+
+func (e *bodyTooLargeError) Error() string {
+	return fmt.Sprintf("%s (limit: %d bytes)", ErrRequestBodyTooLarge, e.limit)
+}
+
+func (e *bodyTooLargeError) Unwrap() error {
+	return e.err
+}
+
+func (e *bodyTooLargeError) Is(target error) bool {
+	return target == ErrRequestBodyTooLarge
+}
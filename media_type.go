@@ -0,0 +1,43 @@
+package router
+
+import (
+	"mime"
+	"strings"
+)
+
+// mediaTypeAccepted reports whether the value of the Content-Type header matches any of the media types.
+func mediaTypeAccepted(contentType string, mediaTypes []string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	for _, s := range mediaTypes {
+		s = strings.ToLower(s)
+		if s == mediaType || s == "*/*" {
+			return true
+		}
+		if strings.HasSuffix(s, "/*") && strings.HasPrefix(mediaType, s[:len(s)-1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptsMediaType reports whether the values of the Accept header list the media type,
+// with a non-zero quality. Wildcards in the header do not select the media type.
+func acceptsMediaType(accept []string, mediaType string) bool {
+	for _, value := range accept {
+		for _, s := range strings.Split(value, ",") {
+			t, params, err := mime.ParseMediaType(strings.TrimSpace(s))
+			if err != nil || !strings.EqualFold(t, mediaType) {
+				continue
+			}
+			if q := strings.TrimSpace(params["q"]); q != "" && strings.Trim(q, "0.") == "" {
+				continue
+			}
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,36 @@
+package router
+
+import (
+	"net/http"
+)
+
+// MethodGroup adds routes with the same set of methods to a router.
+type MethodGroup struct {
+	router  *Router
+	methods []string
+}
+
+// Methods returns a builder adding routes for handling the methods, so that a set of methods
+// shared by many routes can be declared once.
+func (router *Router) Methods(methods ...string) *MethodGroup {
+	return &MethodGroup{
+		router:  router,
+		methods: append([]string(nil), methods...),
+	}
+}
+
+// NewRoute creates and returns a route for handling the methods of the group.
+// Each route has its own conditions and name, as if it were created with Router.NewRoute.
+func (group *MethodGroup) NewRoute(path string) *Route {
+	return group.router.NewRoute(path, group.methods...)
+}
+
+// Handle creates a route for handling the methods of the group with the handler, and returns it.
+func (group *MethodGroup) Handle(path string, handler http.Handler) *Route {
+	return group.NewRoute(path).Handle(handler)
+}
+
+// HandleFunc creates a route for handling the methods of the group with the function, and returns it.
+func (group *MethodGroup) HandleFunc(path string, handlerFunc http.HandlerFunc) *Route {
+	return group.NewRoute(path).HandleFunc(handlerFunc)
+}
@@ -4,8 +4,32 @@ import (
 	"net/http"
 )
 
+// MiddlewareFunc is a function wrapping a handler.
+//
+// For a matched route, the middleware functions run in the following order, from outermost to innermost:
+//   - the functions added with UseGlobal, which also run for unmatched requests;
+//   - the functions added with Use to the router itself;
+//   - the functions added with Use to the groups containing the route, from outer to inner groups;
+//   - the functions added with UseForTag for the tags of the route;
+//   - the functions wrapping the handler of the route, if any.
+//
+// Within each scope, the functions run in the order they have been added.
+// A group gets the middleware functions its parent has at the moment the group is created.
 type MiddlewareFunc func(http.Handler) http.Handler
 
+// Tap returns a middleware function that passes "enter " and "exit " followed by the label to sink
+// when the request enters and leaves the wrapped handler, e.g. to check the order of middleware in tests.
+func Tap(label string, sink func(string)) MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			sink("enter " + label)
+			defer sink("exit " + label)
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 type middlewareList []MiddlewareFunc
 
 func (middleware middlewareList) clone() middlewareList {
@@ -0,0 +1,78 @@
+package router
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// NearMiss describes a route whose pattern matched the path of a request, but whose conditions failed,
+// e.g. for /users/abc and the route /users/{id} with a numeric id.
+type NearMiss struct {
+	Route *Route
+
+	// Params are the named parameters the route would have received.
+	Params Params
+
+	// Param is the name of the parameter whose condition failed, and Value is its value.
+	// Param is empty if a condition of the request failed, such as WhereHeader or Consumes.
+	Param string
+	Value string
+
+	// Pattern is the source of the regular expression of the failed condition, if it is known.
+	Pattern string
+}
+
+type nearMissesKeyType struct{}
+
+var nearMissesKey = nearMissesKeyType{}
+
+// NearMissesFromRequest returns the routes whose patterns matched the path of the request,
+// but whose conditions failed, in the order they have been tried,
+// so that the NotFound handler, or the handler of a failed condition, can respond with a helpful message,
+// e.g. "id must be numeric". It returns nil if no route nearly matched.
+func NearMissesFromRequest(r *http.Request) []NearMiss {
+	misses, _ := r.Context().Value(nearMissesKey).([]NearMiss)
+	return misses
+}
+
+// missRef is a route whose conditions failed, recorded while matching,
+// where param is the position of the parameter whose condition failed, or -1 if a condition of the request failed.
+type missRef struct {
+	route  *Route
+	params httprouter.Params
+	param  int
+}
+
+// nearMisses describes the routes whose conditions failed.
+func nearMisses(failed []missRef) []NearMiss {
+	if len(failed) == 0 {
+		return nil
+	}
+
+	misses := make([]NearMiss, len(failed))
+	for k, f := range failed {
+		misses[k] = NearMiss{
+			Route:  f.route,
+			Params: f.route.namedParams(f.params),
+		}
+		if i := f.param; i >= 0 {
+			misses[k].Param = f.route.paramNames[i]
+			misses[k].Value = f.params[i].Value
+			misses[k].Pattern = f.route.conditions[i].pattern
+		}
+	}
+	return misses
+}
+
+// withNearMisses returns a shallow copy of the request with the near misses stored in its context,
+// or the request itself if there are none.
+func withNearMisses(r *http.Request, misses []NearMiss) *http.Request {
+	if len(misses) == 0 {
+		return r
+	}
+
+	ctx := context.WithValue(r.Context(), nearMissesKey, misses)
+	return r.WithContext(ctx)
+}
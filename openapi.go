@@ -0,0 +1,123 @@
+package router
+
+import (
+	"strings"
+)
+
+// openAPIMethods holds the methods which can be described by an OpenAPI path item.
+var openAPIMethods = map[string]bool{
+	"get":     true,
+	"put":     true,
+	"post":    true,
+	"delete":  true,
+	"options": true,
+	"head":    true,
+	"patch":   true,
+	"trace":   true,
+}
+
+// OpenAPIPaths returns an OpenAPI paths object describing the routes of the router.
+// It can be used to bootstrap API documentation from the route definitions.
+//
+// Only the paths, methods, names (as operation IDs), tags, deprecation and path parameters are described.
+// Since operation IDs must be unique, the name of a route described for several methods
+// is suffixed with the method, e.g. "articles.item.get" and "articles.item.delete".
+// Regular expressions validating the parameters are included as schema patterns.
+// A catch-all parameter {name...} is described as a regular parameter {name}.
+// If several routes have the same pattern and method, only the first one is described.
+// Routes without handlers and methods unknown to OpenAPI, such as CONNECT, are skipped.
+func (router *Router) OpenAPIPaths() map[string]interface{} {
+	type operation struct {
+		route *Route
+		key   string
+		value map[string]interface{}
+	}
+
+	paths := make(map[string]interface{})
+	var operations []operation
+	names := make(map[string]int)
+
+	for _, route := range router.Routes() {
+		if !route.HasHandler() {
+			continue
+		}
+
+		path := paramRegexp.ReplaceAllString(route.Pattern(), "{$1}")
+
+		item, ok := paths[path].(map[string]interface{})
+		if !ok {
+			item = make(map[string]interface{})
+		}
+
+		for _, method := range route.methods {
+			key := strings.ToLower(method)
+			if _, ok := item[key]; ok || !openAPIMethods[key] {
+				continue
+			}
+
+			value := route.openAPIOperation()
+			item[key] = value
+			operations = append(operations, operation{route, key, value})
+			if route.name != "" {
+				names[route.name]++
+			}
+		}
+
+		if len(item) > 0 {
+			paths[path] = item
+		}
+	}
+
+	for _, op := range operations {
+		switch n := names[op.route.name]; {
+		case n == 1:
+			op.value["operationId"] = op.route.name
+		case n > 1:
+			op.value["operationId"] = op.route.name + "." + op.key
+		}
+	}
+
+	return paths
+}
+
+func (route *Route) openAPIOperation() map[string]interface{} {
+	operation := map[string]interface{}{
+		"responses": map[string]interface{}{
+			"default": map[string]interface{}{
+				"description": "Default response",
+			},
+		},
+	}
+
+	if len(route.tags) > 0 {
+		operation["tags"] = route.Tags()
+	}
+
+	if route.deprecated {
+		operation["deprecated"] = true
+	}
+
+	if len(route.paramNames) > 0 {
+		patterns := route.Conditions()
+
+		parameters := make([]interface{}, len(route.paramNames))
+		for i, name := range route.paramNames {
+			schema := map[string]interface{}{
+				"type": "string",
+			}
+			if pattern, ok := patterns[name]; ok {
+				schema["pattern"] = pattern
+			}
+
+			parameters[i] = map[string]interface{}{
+				"name":     name,
+				"in":       "path",
+				"required": true,
+				"schema":   schema,
+			}
+		}
+		operation["parameters"] = parameters
+	}
+
+	return operation
+}
@@ -0,0 +1,21 @@
+package router
+
+import (
+	"log"
+	"net/http"
+	"runtime/debug"
+)
+
+// PanicLogger returns a panic handler that logs the panic and the stack trace,
+// to be used with UsePanicHandler. If logger is nil, the standard logger is used.
+// The handler does not write the response.
+func PanicLogger(logger *log.Logger) func(http.ResponseWriter, *http.Request, interface{}) {
+	return func(w http.ResponseWriter, r *http.Request, rcv interface{}) {
+		printf := log.Printf
+		if logger != nil {
+			printf = logger.Printf
+		}
+
+		printf("panic: %s %s: %v\n%s", r.Method, r.URL, rcv, debug.Stack())
+	}
+}
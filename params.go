@@ -2,7 +2,11 @@ package router
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"net/http"
+	"net/url"
+	"reflect"
 )
 
 type Params []Param
@@ -22,6 +26,64 @@ func ParamsFromRequest(r *http.Request) Params {
 	return params
 }
 
+// ParamsMapFromRequest retrieves a map of named parameters from an HTTP request.
+// The values are empty interfaces. The map is never nil, so it can be passed to templates as is.
+func ParamsMapFromRequest(r *http.Request) map[string]interface{} {
+	return ParamsFromRequest(r).InterfaceMap()
+}
+
+// ParamsStringMapFromRequest retrieves a map of named parameters from an HTTP request.
+// The values are strings. The map is never nil.
+func ParamsStringMapFromRequest(r *http.Request) map[string]string {
+	return ParamsFromRequest(r).Map()
+}
+
+type matchedWildcardKeyType struct{}
+
+var matchedWildcardKey = matchedWildcardKeyType{}
+
+// MatchedWildcard reports whether the request has been matched by a route with a catch-all parameter,
+// such as /files/{path...}, rather than by an exact pattern, e.g. to apply a different cache TTL.
+//
+// Like the named parameters, the flag is set when the route is matched, after the middleware functions
+// added with Use and UseGlobal. Middleware can still read it after calling the next handler,
+// if it passes the request on as is, since the request is updated in place.
+func MatchedWildcard(r *http.Request) bool {
+	matched, _ := r.Context().Value(matchedWildcardKey).(bool)
+	return matched
+}
+
+// AddParam returns a shallow copy of the request with the parameter added to its named parameters,
+// or with the value of an existing parameter with the same key replaced,
+// e.g. for middleware deriving a tenant from the host name.
+//
+// Handlers cannot distinguish such parameters from the parameters of the path.
+// When a request passes through middleware added with Use, the parameters of the path
+// are only known after the middleware functions, so they are added to the parameters set here,
+// taking precedence over the parameters with the same keys.
+func AddParam(r *http.Request, key string, value string) *http.Request {
+	params := ParamsFromRequest(r)
+
+	added := make(Params, len(params), len(params)+1)
+	copy(added, params)
+
+	for i, p := range added {
+		if p.Key == key {
+			added[i].Value = value
+			return SetParams(r, added)
+		}
+	}
+
+	return SetParams(r, append(added, Param{Key: key, Value: value}))
+}
+
+// SetParams returns a shallow copy of the request with the named parameters replaced.
+// See AddParam for how they are combined with the parameters of the path.
+func SetParams(r *http.Request, params Params) *http.Request {
+	ctx := context.WithValue(r.Context(), paramsKey, params)
+	return r.WithContext(ctx)
+}
+
 // ByName returns the value of a parameter by its name.
 func (params Params) ByName(name string) string {
 	for _, p := range params {
@@ -32,6 +94,22 @@ func (params Params) ByName(name string) string {
 	return ""
 }
 
+// At returns the parameter at the position i, in the order of the pattern,
+// and reports whether there is such a parameter.
+func (params Params) At(i int) (Param, bool) {
+	if i < 0 || i >= len(params) {
+		return Param{}, false
+	}
+	return params[i], true
+}
+
+// ValueAt returns the value of the parameter at the position i,
+// or an empty string if there is no such parameter.
+func (params Params) ValueAt(i int) string {
+	p, _ := params.At(i)
+	return p.Value
+}
+
 // Values returns an array of strings with the values of all parameters.
 func (params Params) Values() []string {
 	a := make([]string, len(params))
@@ -68,6 +146,85 @@ func (params Params) InterfaceMap() map[string]interface{} {
 	return m
 }
 
+// JSON returns the parameters encoded as a JSON object of names and values, e.g. for logging.
+// The keys are sorted; if a key is repeated, the last value is used, as in Map.
+// Parameters without values are encoded as empty strings, and no parameters as "{}".
+func (params Params) JSON() ([]byte, error) {
+	return json.Marshal(params.Map())
+}
+
+// AppendTo adds the values of all parameters to v, e.g. to build the query of a request to another service.
+// The values of existing keys are kept, so a key present in both gets several values.
+func (params Params) AppendTo(v url.Values) {
+	for _, p := range params {
+		v.Add(p.Key, p.Value)
+	}
+}
+
+// Range calls fn for each parameter in the order of the pattern, without allocating memory.
+// If fn returns false, Range stops the iteration.
+func (params Params) Range(fn func(key, value string) bool) {
+	for _, p := range params {
+		if !fn(p.Key, p.Value) {
+			return
+		}
+	}
+}
+
+// Scan copies the values of parameters into the fields of the struct pointed to by dest.
+// The name of a parameter is specified by the tag "param" of a field, e.g. `param:"id"`,
+// or is the name of the field if there is no tag. Fields with the tag `param:"-"` are skipped,
+// as well as fields without a corresponding parameter.
+// The values are converted to strings, booleans, integers or floating-point numbers
+// depending on the types of the fields.
+func (params Params) Scan(dest interface{}) error {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("%w: %T is not a pointer to a struct", ErrInvalidDestination, dest)
+	}
+
+	v = v.Elem()
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name := field.Tag.Get("param")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		s, ok := params.lookup(name)
+		if !ok {
+			continue
+		}
+
+		err := setValue(v.Field(i), s)
+		if err != nil {
+			return fmt.Errorf("%w: field %s, parameter %s: %s",
+				ErrInvalidParameter, field.Name, name, err,
+			)
+		}
+	}
+
+	return nil
+}
+
+func (params Params) lookup(name string) (string, bool) {
+	for _, p := range params {
+		if p.Key == name {
+			return p.Value, true
+		}
+	}
+	return "", false
+}
+
 func (params Params) toRequest(r *http.Request) {
 	ctx := r.Context()
 	ctx = context.WithValue(ctx, paramsKey, params)
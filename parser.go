@@ -10,55 +10,78 @@ import (
 )
 
 var (
-	parserRouteRegexp = regexp.MustCompile(`^(((GET|POST|PUT|PATCH|DELETE|OPTIONS)\b(,\s*)?)+)(\s+(.*))?$`)
+	// A route key is a comma-separated list of methods, optionally followed by whitespace and a path.
+	// Whitespace around the methods and the path is ignored.
+	parserRouteRegexp = regexp.MustCompile(
+		`^\s*((?:GET|POST|PUT|PATCH|DELETE|OPTIONS)\b(?:\s*,\s*(?:GET|POST|PUT|PATCH|DELETE|OPTIONS)\b)*)(?:\s+(.*?))?\s*$`,
+	)
 	parserGroupRegexp = regexp.MustCompile(`^\(.*\)$`)
-
-	regexpCache = regexpMap{}
 )
 
 type parser struct {
 	router           *Router
 	handlerByName    func(string) http.Handler
 	middlewareByName func(string) MiddlewareFunc
+	nested           bool
 }
 
+// parserKeywords lists the keywords in the order they are parsed:
+// the conditions and the middleware of the block come first, so that they apply to the handlers
+// set with $notfound and $methodnotallowed, and to the routes of $group and $prefix.
+var parserKeywords = []string{"$where", "$use", "$notfound", "$methodnotallowed", "$group", "$prefix"}
+
+// ParseMap parses the keywords before the other keys, so that $use and $where apply to all routes of the block,
+// even to the keys sorted before them, such as the ones starting with whitespace.
 func (p *parser) ParseMap(m map[string]interface{}) {
+	for _, k := range parserKeywords {
+		if v, ok := m[k]; ok {
+			p.parseKeyword(k, v)
+		}
+	}
+
 	keys := helpers.Map[string, interface{}](m).SortedKeys()
 	for _, k := range keys {
-		v := m[k]
-		p.parseKeyValue(k, v)
+		if k[0] != '$' {
+			p.parseKeyValue(k, m[k])
+		}
 	}
 }
 
 func (p *parser) parseKeyValue(k string, v interface{}) {
-	if k[0] == '$' {
-		p.parseKeyword(k, v)
-		return
-	}
-
 	if a := parserRouteRegexp.FindStringSubmatch(k); len(a) > 0 {
 		p.parseRoute(a, v)
 	} else if m, ok := v.(map[string]interface{}); ok {
 		if parserGroupRegexp.MatchString(k) {
-			p.router.Group(func(r *Router) {
-				r.ParseMap(m, p.handlerByName, p.middlewareByName)
-			})
+			p.parseGroup(m)
 		} else {
-			p.router.Prefix(k, func(r *Router) {
-				r.ParseMap(m, p.handlerByName, p.middlewareByName)
-			})
+			p.parsePrefix(k, m)
 		}
 	}
 }
 
+func (p *parser) parseGroup(m map[string]interface{}) {
+	p.router.Group(func(r *Router) {
+		p.sub(r).ParseMap(m)
+	})
+}
+
+func (p *parser) parsePrefix(path string, m map[string]interface{}) {
+	p.router.Prefix(path, func(r *Router) {
+		p.sub(r).ParseMap(m)
+	})
+}
+
 func (p *parser) parseKeyword(k string, v interface{}) {
 	switch k {
 	case "$where":
 		conditions := v.(map[string]interface{})
 		for k, v := range conditions {
 			s := fmt.Sprint(v)
-			r := regexpCache.Get(s)
-			p.router.Where(k, r)
+			r := p.router.Regexp(s)
+			p.router.inheritWhere(k, condition{
+				match:   r.MatchString,
+				pattern: r.String(),
+			})
 		}
 	case "$use":
 		switch t := v.(type) {
@@ -76,6 +99,58 @@ func (p *parser) parseKeyword(k string, v interface{}) {
 				}
 			}
 		}
+	case "$group":
+		for _, m := range parserSubmaps(k, v) {
+			p.parseGroup(m)
+		}
+	case "$prefix":
+		for _, m := range parserSubmaps(k, v) {
+			path, ok := m["$path"].(string)
+			if !ok {
+				panic("missing $path in " + k)
+			}
+			p.parsePrefix(path, m)
+		}
+	case "$notfound":
+		p.router.HandleNotFound(p.topLevelHandler(k, v))
+	case "$methodnotallowed":
+		p.router.HandleMethodNotAllowed(p.topLevelHandler(k, v))
+	}
+}
+
+func (p *parser) topLevelHandler(k string, v interface{}) http.Handler {
+	if p.nested {
+		panic("keyword is only allowed at the top level: " + k)
+	}
+	return p.handlerByName(fmt.Sprint(v))
+}
+
+// parserSubmaps returns the value of a keyword that takes either a map or a list of maps.
+func parserSubmaps(k string, v interface{}) []map[string]interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		return []map[string]interface{}{t}
+	case []interface{}:
+		a := make([]map[string]interface{}, len(t))
+		for i, v := range t {
+			m, ok := v.(map[string]interface{})
+			if !ok {
+				panic("invalid value of " + k)
+			}
+			a[i] = m
+		}
+		return a
+	default:
+		panic("invalid value of " + k)
+	}
+}
+
+func (p *parser) sub(router *Router) *parser {
+	return &parser{
+		router:           router,
+		handlerByName:    p.handlerByName,
+		middlewareByName: p.middlewareByName,
+		nested:           true,
 	}
 }
 
@@ -101,11 +176,11 @@ func (p *parser) parseRoute(a []string, v interface{}) {
 	}
 
 	methods := helpers.Slice[string](strings.Split(a[1], ",")).Map(strings.TrimSpace)
-	path := a[6]
+	path := a[2]
 
 	route := p.router.NewRoute(path, methods...).Name(name).Handle(p.handlerByName(name))
 	for k, v := range conditions {
-		r := regexp.MustCompile(v)
+		r := p.router.Regexp(v)
 		route.Where(k, r)
 	}
 }
@@ -0,0 +1,87 @@
+package router
+
+import (
+	"net/http"
+	"regexp"
+)
+
+// PathRoutes adds routes with the same path and distinct names per method to a router,
+// e.g. to show a form with GET and to submit it with POST.
+type PathRoutes struct {
+	router *Router
+	path   string
+	wheres []pathWhere
+	routes []*Route
+}
+
+type pathWhere struct {
+	param  string
+	regexp *regexp.Regexp
+}
+
+// Route returns a builder adding routes for the path, each with its own method, name and handler,
+// so that Url resolves the name of each method separately:
+//
+//	r.Route("/form").
+//		GetNamed("page.show", showHandler).
+//		PostNamed("page.submit", submitHandler)
+//
+// Each route is a separate Route, as if it were created with NewRoute.
+func (router *Router) Route(path string) *PathRoutes {
+	return &PathRoutes{
+		router: router,
+		path:   path,
+	}
+}
+
+// Where sets a regular expression for validating a named parameter of all routes of the builder,
+// both the ones added before and after.
+func (pr *PathRoutes) Where(param string, regexp *regexp.Regexp) *PathRoutes {
+	pr.wheres = append(pr.wheres, pathWhere{param: param, regexp: regexp})
+	for _, route := range pr.routes {
+		route.Where(param, regexp)
+	}
+	return pr
+}
+
+// Named adds a route for handling the method with the handler, and gives it the name.
+func (pr *PathRoutes) Named(method string, name string, handler http.Handler) *PathRoutes {
+	route := pr.router.NewRoute(pr.path, method).Name(name)
+	for _, w := range pr.wheres {
+		route.Where(w.param, w.regexp)
+	}
+	route.Handle(handler)
+
+	pr.routes = append(pr.routes, route)
+	return pr
+}
+
+// GetNamed adds a route for handling GET requests, and gives it the name.
+func (pr *PathRoutes) GetNamed(name string, handler http.Handler) *PathRoutes {
+	return pr.Named(http.MethodGet, name, handler)
+}
+
+// PostNamed adds a route for handling POST requests, and gives it the name.
+func (pr *PathRoutes) PostNamed(name string, handler http.Handler) *PathRoutes {
+	return pr.Named(http.MethodPost, name, handler)
+}
+
+// PutNamed adds a route for handling PUT requests, and gives it the name.
+func (pr *PathRoutes) PutNamed(name string, handler http.Handler) *PathRoutes {
+	return pr.Named(http.MethodPut, name, handler)
+}
+
+// PatchNamed adds a route for handling PATCH requests, and gives it the name.
+func (pr *PathRoutes) PatchNamed(name string, handler http.Handler) *PathRoutes {
+	return pr.Named(http.MethodPatch, name, handler)
+}
+
+// DeleteNamed adds a route for handling DELETE requests, and gives it the name.
+func (pr *PathRoutes) DeleteNamed(name string, handler http.Handler) *PathRoutes {
+	return pr.Named(http.MethodDelete, name, handler)
+}
+
+// Routes returns the routes added by the builder, in the order they have been added.
+func (pr *PathRoutes) Routes() []*Route {
+	return append([]*Route(nil), pr.routes...)
+}
@@ -5,15 +5,38 @@ import (
 	"regexp"
 	"strings"
 
+	"github.com/julienschmidt/httprouter"
+
 	"github.com/olegshs/router/helpers"
 )
 
 type pattern string
 
 var (
-	paramRegexp = regexp.MustCompile(`{([A-Za-z_][0-9A-Za-z_]*)(\.\.\.)?}`)
+	// The name of a parameter can consist of several identifiers separated by dots, e.g. {user.id}.
+	paramRegexp = regexp.MustCompile(`{([A-Za-z_][0-9A-Za-z_]*(?:\.[A-Za-z_][0-9A-Za-z_]*)*)(\.\.\.)?}`)
+
+	httpRouterParamRegexp = regexp.MustCompile(`/\*(\d+)|:(\d+)`)
 )
 
+// join appends a path to the pattern.
+// A slash is not duplicated if the pattern ends with one and the path starts with one.
+func (p pattern) join(path string) pattern {
+	if strings.HasSuffix(string(p), "/") && strings.HasPrefix(path, "/") {
+		path = path[1:]
+	}
+	return p + pattern(path)
+}
+
+// routePattern returns the pattern to be registered for a route.
+// An empty pattern is treated as the root path.
+func (p pattern) routePattern() pattern {
+	if p == "" {
+		return "/"
+	}
+	return p
+}
+
 func (p pattern) paramNames() helpers.Slice[string] {
 	a := p.paramNamesMatch()
 	names := make([]string, len(a))
@@ -29,23 +52,156 @@ func (p pattern) paramNamesMatch() [][]string {
 	return paramRegexp.FindAllStringSubmatch(string(p), -1)
 }
 
+// prefixRegexp returns a regular expression matching the paths starting with the pattern,
+// treated as a sequence of whole segments.
+func (p pattern) prefixRegexp() *regexp.Regexp {
+	s := strings.TrimSuffix(string(p), "/")
+
+	expr := "^"
+	last := 0
+	for _, loc := range paramRegexp.FindAllStringSubmatchIndex(s, -1) {
+		expr += regexp.QuoteMeta(s[last:loc[0]])
+		if loc[4] >= 0 {
+			expr += ".*"
+		} else {
+			expr += "[^/]+"
+		}
+		last = loc[1]
+	}
+	expr += regexp.QuoteMeta(s[last:]) + "(/|$)"
+
+	return regexp.MustCompile(expr)
+}
+
+// matchExpr returns a regular expression matching the paths of the pattern,
+// with a group for each parameter.
+func (p pattern) matchExpr() string {
+	s := string(p)
+
+	expr := "^"
+	last := 0
+	for _, loc := range paramRegexp.FindAllStringSubmatchIndex(s, -1) {
+		expr += regexp.QuoteMeta(s[last:loc[0]])
+		if loc[4] >= 0 {
+			expr += "(.*)"
+		} else {
+			expr += "([^/]+)"
+		}
+		last = loc[1]
+	}
+	expr += regexp.QuoteMeta(s[last:]) + "$"
+
+	return expr
+}
+
+// httpRouterString converts the pattern to the syntax of httprouter.
+//
+// Since httprouter allows only one parameter per path segment, a segment containing
+// several parameters or a parameter combined with text, such as {id}.{format},
+// is registered as a single parameter, whose value is split by the expressions
+// returned by splitters.
 func (p pattern) httpRouterString() string {
 	s := string(p)
 	s = strings.ReplaceAll(s, ":", "")
 	s = strings.ReplaceAll(s, "*", "")
 
-	a := paramRegexp.FindAllStringSubmatch(s, -1)
+	segments := strings.Split(s, "/")
+	n := 0
 
-	for i, m := range a {
-		var repl string
-		if m[2] == "..." {
-			repl = fmt.Sprintf("*%d", i)
+	for i, segment := range segments {
+		a := paramRegexp.FindAllStringSubmatch(segment, -1)
+		if len(a) == 0 {
+			continue
+		}
+
+		if len(a) == 1 && a[0][0] == segment && a[0][2] == "..." {
+			segments[i] = fmt.Sprintf("*%d", n)
 		} else {
-			repl = fmt.Sprintf(":%d", i)
+			segments[i] = fmt.Sprintf(":%d", n)
 		}
+		n++
+	}
 
-		s = strings.ReplaceAll(s, m[0], repl)
+	return strings.Join(segments, "/")
+}
+
+// hasCatchAll reports whether the pattern has a catch-all parameter, such as {path...},
+// i.e. a parameter taking a whole segment and the rest of the path.
+func (p pattern) hasCatchAll() bool {
+	return strings.Contains(p.httpRouterString(), "/*")
+}
+
+// splitters returns, for each parameter of httprouter, a regular expression splitting its value
+// into the values of several parameters of the pattern, or nil if the parameter of httprouter
+// corresponds to a single parameter of the pattern.
+// The result is nil if the pattern has no compound segments.
+//
+// Each parameter in a compound segment takes as many characters as possible,
+// so for the segment {id}.{format} and the value "a.tar.gz", id is "a.tar" and format is "gz".
+func (p pattern) splitters() []*regexp.Regexp {
+	s := string(p)
+	s = strings.ReplaceAll(s, ":", "")
+	s = strings.ReplaceAll(s, "*", "")
+
+	var splitters []*regexp.Regexp
+	compound := false
+
+	for _, segment := range strings.Split(s, "/") {
+		a := paramRegexp.FindAllStringSubmatchIndex(segment, -1)
+		if len(a) == 0 {
+			continue
+		}
+
+		if len(a) == 1 && a[0][0] == 0 && a[0][1] == len(segment) {
+			splitters = append(splitters, nil)
+			continue
+		}
+
+		expr := "^"
+		last := 0
+		for _, m := range a {
+			if m[4] >= 0 {
+				panic("catch-all parameter must be a whole segment: " + segment)
+			}
+
+			expr += regexp.QuoteMeta(segment[last:m[0]]) + "(.+)"
+			last = m[1]
+		}
+		expr += regexp.QuoteMeta(segment[last:]) + "$"
+
+		splitters = append(splitters, regexp.MustCompile(expr))
+		compound = true
+	}
+
+	if !compound {
+		return nil
+	}
+	return splitters
+}
+
+// splitParams splits the values of parameters of httprouter by the expressions returned by splitters.
+// It reports false if any value does not match its expression.
+func splitParams(params httprouter.Params, splitters []*regexp.Regexp) (httprouter.Params, bool) {
+	if splitters == nil {
+		return params, true
+	}
+
+	a := make(httprouter.Params, 0, len(params)+len(splitters))
+	for i, param := range params {
+		if i >= len(splitters) || splitters[i] == nil {
+			a = append(a, param)
+			continue
+		}
+
+		m := splitters[i].FindStringSubmatch(param.Value)
+		if m == nil {
+			return nil, false
+		}
+
+		for _, v := range m[1:] {
+			a = append(a, httprouter.Param{Key: param.Key, Value: v})
+		}
 	}
 
-	return s
+	return a, true
 }
@@ -2,15 +2,28 @@ package router
 
 import (
 	"regexp"
+	"sync"
 )
 
-type regexpMap map[string]*regexp.Regexp
+type regexpMap struct {
+	mu sync.Mutex
+	m  map[string]*regexp.Regexp
+}
+
+func newRegexpMap() *regexpMap {
+	return &regexpMap{
+		m: make(map[string]*regexp.Regexp),
+	}
+}
+
+func (m *regexpMap) Get(s string) *regexp.Regexp {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-func (m regexpMap) Get(s string) *regexp.Regexp {
-	r, ok := m[s]
+	r, ok := m.m[s]
 	if !ok {
 		r = regexp.MustCompile(s)
-		m[s] = r
+		m.m[s] = r
 	}
 	return r
 }
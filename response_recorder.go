@@ -0,0 +1,96 @@
+package router
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+)
+
+// ResponseRecorder wraps http.ResponseWriter and records the status code
+// and the size of the response. It is intended to be used by middleware functions.
+//
+// ResponseRecorder implements http.Flusher and http.Hijacker by delegating to the underlying writer,
+// so streaming and websocket handlers keep working through the middleware chain.
+type ResponseRecorder struct {
+	http.ResponseWriter
+	status      int
+	size        int64
+	wroteHeader bool
+}
+
+// NewResponseRecorder creates a new instance of ResponseRecorder.
+func NewResponseRecorder(w http.ResponseWriter) *ResponseRecorder {
+	return &ResponseRecorder{
+		ResponseWriter: w,
+		status:         http.StatusOK,
+	}
+}
+
+// Status returns the status code of the response.
+func (rec *ResponseRecorder) Status() int {
+	return rec.status
+}
+
+// Size returns the number of bytes written to the response body.
+func (rec *ResponseRecorder) Size() int64 {
+	return rec.size
+}
+
+// WroteHeader reports whether the header has been written.
+func (rec *ResponseRecorder) WroteHeader() bool {
+	return rec.wroteHeader
+}
+
+// WriteHeader implements the http.ResponseWriter interface.
+func (rec *ResponseRecorder) WriteHeader(status int) {
+	if rec.wroteHeader {
+		return
+	}
+
+	rec.status = status
+	rec.wroteHeader = true
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+// Write implements the http.ResponseWriter interface.
+func (rec *ResponseRecorder) Write(b []byte) (int, error) {
+	if !rec.wroteHeader {
+		rec.WriteHeader(http.StatusOK)
+	}
+
+	n, err := rec.ResponseWriter.Write(b)
+	rec.size += int64(n)
+	return n, err
+}
+
+// Flush implements the http.Flusher interface.
+// It does nothing if the underlying writer does not support flushing.
+func (rec *ResponseRecorder) Flush() {
+	if f, ok := rec.ResponseWriter.(http.Flusher); ok {
+		if !rec.wroteHeader {
+			rec.WriteHeader(http.StatusOK)
+		}
+		f.Flush()
+	}
+}
+
+// Hijack implements the http.Hijacker interface.
+// It returns ErrHijackNotSupported if the underlying writer does not support hijacking.
+func (rec *ResponseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := rec.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, ErrHijackNotSupported
+	}
+
+	conn, rw, err := h.Hijack()
+	if err == nil {
+		rec.status = http.StatusSwitchingProtocols
+		rec.wroteHeader = true
+	}
+	return conn, rw, err
+}
+
+// Unwrap returns the underlying writer. It is used by http.ResponseController.
+func (rec *ResponseRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
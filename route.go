@@ -1,11 +1,17 @@
 package router
 
 import (
+	"context"
 	"fmt"
 	"net/http"
+	"net/url"
+	"reflect"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
 
@@ -13,36 +19,361 @@ import (
 )
 
 type Route struct {
-	router          *Router
-	methods         []string
-	pattern         pattern
-	paramNames      helpers.Slice[string]
-	paramNamesMatch [][]string
-	conditions      conditions
-	handler         http.Handler
+	router            *Router
+	name              string
+	methods           []string
+	pattern           pattern
+	paramNames        helpers.Slice[string]
+	paramNamesMatch   [][]string
+	splitters         []*regexp.Regexp
+	catchAll          bool
+	conditions        conditions
+	requestConditions requestConditions
+	transforms        transforms
+	defaults          map[int]string
+	handler           http.Handler
+	disabled          int32
+	skipMiddleware    bool
+	deprecated        bool
+	sunset            time.Time
+	priority          int
+	middleware        middlewareList
+	stats             *routeStats
+	validators        []func(*http.Request) error
+	tags              []string
+	ownMiddleware     middlewareList
+	wrapped           http.Handler
 }
 
 // Name sets a name of the route.
+//
+// Routes with the same name and pattern, e.g. the GET and POST routes of a form created separately,
+// are one named route, and Url uses the first of them. If the pattern differs,
+// the name refers to the last route given it, and Router.Validate reports ErrDuplicateName.
+// Name has no effect on the routes added by Router.Version without the prefix.
 func (route *Route) Name(name string) *Route {
-	route.router.routeByName[name] = route
+	if route.router.unnamed {
+		return route
+	}
+
+	route.name = name
+	if named, ok := route.router.routeByName[name]; !ok || named.name != name || named.pattern != route.pattern {
+		route.router.routeByName[name] = route
+	}
 	return route
 }
 
+// GetName returns the name of the route, or an empty string if the route has no name.
+func (route *Route) GetName() string {
+	return route.name
+}
+
+// Pattern returns the pattern of the route, including the prefix.
+func (route *Route) Pattern() string {
+	return string(route.pattern)
+}
+
+// HttpRouterPattern returns the pattern of the route as it is registered in httprouter,
+// with parameters replaced by their positions, e.g. "/users/:0/files/*1" for "/users/{id}/files/{path...}".
+// Patterns that differ only in the names of parameters are the same for httprouter,
+// and share a list of routes matched by the conditions.
+func (route *Route) HttpRouterPattern() string {
+	return route.pattern.httpRouterString()
+}
+
+// Methods returns the methods handled by the route.
+func (route *Route) Methods() []string {
+	return append([]string(nil), route.methods...)
+}
+
+// HasHandler reports whether a handler is set for the route.
+func (route *Route) HasHandler() bool {
+	return route.handler != nil
+}
+
+// HasConditions reports whether any conditions are set for the route.
+func (route *Route) HasConditions() bool {
+	for _, cond := range route.conditions {
+		if cond.match != nil {
+			return true
+		}
+	}
+	return len(route.requestConditions) > 0
+}
+
+// Conditions returns the regular expressions set for validating named parameters,
+// including the ones inherited from prefixes. Conditions set with WhereFunc are not included,
+// as well as conditions combined with AndWhere, which cannot be expressed by one regular expression.
+func (route *Route) Conditions() map[string]string {
+	m := make(map[string]string)
+	for i, cond := range route.conditions {
+		if cond.pattern != "" {
+			m[route.paramNames[i]] = cond.pattern
+		}
+	}
+	return m
+}
+
+// String returns the methods and the pattern of the route, e.g. "GET,POST /articles".
+func (route *Route) String() string {
+	return strings.Join(route.methods, ",") + " " + string(route.pattern)
+}
+
 // Where sets a regular expression for validating a named parameter.
 func (route *Route) Where(param string, regex *regexp.Regexp) *Route {
-	return route.WhereFunc(param, func(v string) bool {
-		return regex.MatchString(v)
+	return route.where(param, condition{
+		match:   regex.MatchString,
+		pattern: regex.String(),
 	})
 }
 
 // WhereFunc sets a function for validating a named parameter.
 func (route *Route) WhereFunc(param string, matchFunc func(string) bool) *Route {
+	return route.where(param, condition{
+		match: matchFunc,
+	})
+}
+
+func (route *Route) where(param string, cond condition) *Route {
 	i := route.paramNames.IndexOf(param)
 	if i < 0 {
 		panic("unknown parameter: " + param)
 	}
 
-	route.conditions[i] = matchFunc
+	route.conditions.set(i, cond)
+	return route
+}
+
+// AndWhere adds a regular expression to the condition of a named parameter,
+// so that the parameter must match both the condition set before and the expression.
+// Unlike Where, it does not replace the condition. If there is none, it is the same as Where.
+func (route *Route) AndWhere(param string, regex *regexp.Regexp) *Route {
+	return route.combineWhere(param, condition{
+		match:   regex.MatchString,
+		pattern: regex.String(),
+	}, condition.and)
+}
+
+// AndWhereFunc adds a function to the condition of a named parameter, like AndWhere.
+func (route *Route) AndWhereFunc(param string, matchFunc func(string) bool) *Route {
+	return route.combineWhere(param, condition{
+		match: matchFunc,
+	}, condition.and)
+}
+
+// OrWhere adds an alternative regular expression to the condition of a named parameter,
+// so that the parameter must match either the condition set before or the expression.
+// If there is no condition, it is the same as Where.
+func (route *Route) OrWhere(param string, regex *regexp.Regexp) *Route {
+	return route.combineWhere(param, condition{
+		match:   regex.MatchString,
+		pattern: regex.String(),
+	}, condition.or)
+}
+
+// OrWhereFunc adds an alternative function to the condition of a named parameter, like OrWhere.
+func (route *Route) OrWhereFunc(param string, matchFunc func(string) bool) *Route {
+	return route.combineWhere(param, condition{
+		match: matchFunc,
+	}, condition.or)
+}
+
+func (route *Route) combineWhere(param string, cond condition, combine func(condition, condition) condition) *Route {
+	i := route.paramNames.IndexOf(param)
+	if i < 0 {
+		panic("unknown parameter: " + param)
+	}
+
+	if i < len(route.conditions) && route.conditions[i].match != nil {
+		cond = combine(route.conditions[i], cond)
+	}
+
+	route.conditions.set(i, cond)
+	return route
+}
+
+// WhereElse sets a regular expression for validating the named parameter,
+// and a handler that is called if the parameter does not match it,
+// e.g. to respond with 422 Unprocessable Entity to an invalid identifier instead of 404 Not Found.
+//
+// The handler is only called if no other route with the same pattern matches the request:
+// the next routes are still tried, as with Where, and the handler of the first failed condition is used.
+func (route *Route) WhereElse(param string, regex *regexp.Regexp, onFail http.Handler) *Route {
+	return route.where(param, condition{
+		match:   regex.MatchString,
+		pattern: regex.String(),
+		onFail:  onFail,
+	})
+}
+
+// WhereRequest sets a function for validating the request.
+// If the function returns false, the next route with the same pattern is tried.
+// Such conditions are evaluated in the order they have been added,
+// after the conditions of named parameters.
+func (route *Route) WhereRequest(matchFunc func(*http.Request) bool) *Route {
+	route.requestConditions = append(route.requestConditions, requestCondition{
+		match: matchFunc,
+	})
+	return route
+}
+
+// Consumes restricts the media types of request bodies accepted by the route, e.g. "application/json".
+// A media type can end with "/*" to accept any subtype. Parameters such as charset are ignored.
+// Requests with a missing or different Content-Type are rejected with 415 Unsupported Media Type,
+// unless another route with the same pattern matches.
+func (route *Route) Consumes(mediaTypes ...string) *Route {
+	route.requestConditions = append(route.requestConditions, requestCondition{
+		match: func(r *http.Request) bool {
+			return mediaTypeAccepted(r.Header.Get("Content-Type"), mediaTypes)
+		},
+		onFail: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w,
+				http.StatusText(http.StatusUnsupportedMediaType),
+				http.StatusUnsupportedMediaType,
+			)
+		}),
+	})
+	return route
+}
+
+// WhereHeader sets a regular expression for validating the value of a request header.
+// A missing header is treated as an empty value.
+// If no route with the same pattern matches, the NotFound handler is called.
+func (route *Route) WhereHeader(name string, valueRegex string) *Route {
+	r := route.router.Regexp(valueRegex)
+	return route.WhereRequest(func(req *http.Request) bool {
+		return r.MatchString(req.Header.Get(name))
+	})
+}
+
+// WhereQuery sets a regular expression for validating the value of a query parameter.
+// A missing parameter is treated as an empty value; if the parameter is repeated, any value can match.
+//
+// Since the query is usually optional, routing by it can be surprising,
+// so a route with the same pattern and without the condition should follow as a fallback,
+// e.g. for /search?type=image, /search?type=video and /search.
+// If no route with the same pattern matches, the NotFound handler is called.
+func (route *Route) WhereQuery(name string, valueRegex string) *Route {
+	r := route.router.Regexp(valueRegex)
+	return route.WhereRequest(func(req *http.Request) bool {
+		values, ok := req.URL.Query()[name]
+		if !ok {
+			return r.MatchString("")
+		}
+
+		for _, value := range values {
+			if r.MatchString(value) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// Validate adds a function validating the whole request, e.g. its body, headers and parameters,
+// which is called after the route is matched, before the handler.
+// Unlike conditions, a failed validation does not make the router try other routes:
+// if fn returns an error, the function set with Router.SetInvalidRequestHandler is called instead of the handler,
+// by default responding with 400 Bad Request and a JSON object {"error": "..."}.
+// The functions are called in the order they are added.
+func (route *Route) Validate(fn func(*http.Request) error) *Route {
+	route.validators = append(route.validators, fn)
+	return route
+}
+
+// NoTraversal sets a condition for the catch-all parameter {name...} of the route,
+// rejecting values with ".." segments or null bytes, e.g. for routes serving files.
+// Backslashes are treated as separators too, and the value is also checked after unescaping,
+// so that encoded attempts such as "%2e%2e" are rejected even if they are decoded again later.
+// It panics if the pattern has no catch-all parameter.
+func (route *Route) NoTraversal() *Route {
+	for _, m := range route.paramNamesMatch {
+		if m[2] != "" {
+			return route.WhereFunc(m[1], func(s string) bool {
+				return !pathTraversal(s)
+			})
+		}
+	}
+	panic("no catch-all parameter: " + string(route.pattern))
+}
+
+func pathTraversal(s string) bool {
+	if u, err := url.PathUnescape(s); err == nil && u != s && pathTraversal(u) {
+		return true
+	}
+
+	if strings.ContainsRune(s, 0) {
+		return true
+	}
+
+	for _, segment := range strings.FieldsFunc(s, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if segment == ".." {
+			return true
+		}
+	}
+	return false
+}
+
+// WebSocket makes the route match only WebSocket handshake requests, having the Connection header
+// with the "upgrade" token and the Upgrade header with the "websocket" token,
+// so that a WebSocket handler and a regular handler can share the same path.
+// Since the routes with the same pattern are tried in order, the WebSocket route
+// should be added before the regular one, or have a higher priority.
+// If SetTimeout is used, the route should also skip middleware, since the handshake requires hijacking.
+func (route *Route) WebSocket() *Route {
+	return route.WhereRequest(func(r *http.Request) bool {
+		return headerHasToken(r.Header, "Connection", "upgrade") &&
+			headerHasToken(r.Header, "Upgrade", "websocket")
+	})
+}
+
+// headerHasToken reports whether any value of the header contains the token in a comma-separated list, ignoring case.
+func headerHasToken(header http.Header, name string, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, s := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(s), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Transform sets a function for transforming the value of a named parameter,
+// e.g. strings.ToLower. The function is applied after the conditions have been evaluated,
+// so the conditions validate the original value, and the handler receives the transformed one.
+// Several functions for the same parameter are applied in the order they have been set.
+func (route *Route) Transform(param string, fn func(string) string) *Route {
+	i := route.paramNames.IndexOf(param)
+	if i < 0 {
+		panic("unknown parameter: " + param)
+	}
+
+	route.transforms.add(i, fn)
+	return route
+}
+
+// Default sets a value for a named parameter that is used when the parameter is empty,
+// e.g. "1" for the page of /posts/{page...} requested as /posts/.
+// Since the other parameters of httprouter cannot be empty, it only applies to catch-all parameters,
+// and it panics if the parameter is unknown or is not a catch-all one.
+// The default is set before the transforms are applied, and after the conditions have been evaluated,
+// so a condition of the parameter has to accept an empty value.
+//
+// Url omits a catch-all parameter whose value equals the default, so the URL is the canonical one.
+func (route *Route) Default(param string, value string) *Route {
+	i := route.paramNames.IndexOf(param)
+	if i < 0 {
+		panic("unknown parameter: " + param)
+	}
+	if route.paramNamesMatch[i][2] == "" {
+		panic("not a catch-all parameter: " + param)
+	}
+
+	if route.defaults == nil {
+		route.defaults = make(map[int]string)
+	}
+	route.defaults[i] = value
 	return route
 }
 
@@ -57,7 +388,161 @@ func (route *Route) HandleFunc(handlerFunc http.HandlerFunc) *Route {
 	return route.Handle(handlerFunc)
 }
 
+// HandleLazy sets a function that constructs the handler of the route on the first matching request,
+// e.g. when the dependencies of the handler are not ready at the time the routes are added.
+// The function is called by one request at a time, even if several requests arrive simultaneously,
+// and the handler it returns is used for all requests. The route is considered to have a handler.
+//
+// If the function returns nil, the response is 500 Internal Server Error,
+// and if it panics, the panic is propagated to the panic handlers.
+// In both cases the function is called again on the next request.
+func (route *Route) HandleLazy(fn func() http.Handler) *Route {
+	var mu sync.Mutex
+	var done uint32
+	var handler http.Handler
+
+	build := func() http.Handler {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if done == 0 {
+			if h := fn(); h != nil {
+				handler = h
+				atomic.StoreUint32(&done, 1)
+			}
+		}
+		return handler
+	}
+
+	return route.HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+		var h http.Handler
+		if atomic.LoadUint32(&done) != 0 {
+			h = handler
+		} else {
+			h = build()
+		}
+		if h == nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// Disable disables the route, so that it does not match any requests.
+// It is safe to call Disable while the router is serving requests.
+func (route *Route) Disable() *Route {
+	atomic.StoreInt32(&route.disabled, 1)
+	return route
+}
+
+// Enable enables the route disabled by Disable.
+func (route *Route) Enable() *Route {
+	atomic.StoreInt32(&route.disabled, 0)
+	return route
+}
+
+// Disabled reports whether the route is disabled.
+func (route *Route) Disabled() bool {
+	return atomic.LoadInt32(&route.disabled) != 0
+}
+
+// Priority sets the priority of the route, zero by default.
+// Routes with the same pattern and method are tried in the order of their priorities,
+// from highest to lowest, and in the order they have been added if the priorities are equal.
+// This way a route with conditions can precede a route without them, even if it is added later.
+func (route *Route) Priority(n int) *Route {
+	route.priority = n
+
+	p := route.pattern.httpRouterString()
+	for _, method := range route.methods {
+		if routes, ok := route.router.routes[method][p]; ok {
+			routes.sort()
+		}
+	}
+
+	return route
+}
+
+// Deprecated marks the route as deprecated.
+// Responses of the route get the Deprecation header and, unless sunset is zero,
+// the Sunset header with the date after which the route is expected to be removed.
+// Deprecated routes are also marked as such by MarshalRoutes and OpenAPIPaths.
+func (route *Route) Deprecated(sunset time.Time) *Route {
+	route.deprecated = true
+	route.sunset = sunset
+	return route
+}
+
+// IsDeprecated reports whether the route is deprecated.
+func (route *Route) IsDeprecated() bool {
+	return route.deprecated
+}
+
+// Sunset returns the sunset date of a deprecated route, or zero time if it is not set.
+func (route *Route) Sunset() time.Time {
+	return route.sunset
+}
+
+// MiddlewareCount returns the number of middleware functions added with Use or UseForTag that wrap the handler of the route,
+// e.g. to find out why a header is set by a particular route.
+// Only the middleware functions added with Router.UseForTag are counted if the route skips middleware.
+//
+// The routes with the same pattern and method share the middleware of the router or the group
+// that has added the first of them, as it was when the route was added.
+// If the route has several methods, the middleware of the first method is counted.
+func (route *Route) MiddlewareCount() int {
+	if route.skipMiddleware {
+		return len(route.ownMiddleware)
+	}
+	return len(route.middleware) + len(route.ownMiddleware)
+}
+
+// SkipMiddleware makes the route bypass the middleware functions added with Use
+// to the router and its groups, as well as the timeout set with SetTimeout,
+// e.g. for health checks that should not be affected by authentication or logging.
+// The middleware functions added with UseGlobal still apply, since they run before routing.
+//
+// The routes with the same pattern and method are then matched before the middleware functions,
+// rather than after them, so the conditions of requests do not see the changes the middleware makes.
+func (route *Route) SkipMiddleware() *Route {
+	route.skipMiddleware = true
+	route.router.global.skipping = true
+	return route
+}
+
+// RedirectTo sets a handler that redirects requests to the target URL with the status code,
+// such as http.StatusMovedPermanently or http.StatusFound.
+func (route *Route) RedirectTo(target string, code int) *Route {
+	return route.Handle(http.RedirectHandler(target, code))
+}
+
+// RedirectToRoute sets a handler that redirects requests to the URL of a named route
+// generated with the parameters. The URL is generated on each request,
+// so the target route can be defined after this one.
+// If the URL cannot be generated, the response is 500 Internal Server Error.
+func (route *Route) RedirectToRoute(name string, code int, params ...interface{}) *Route {
+	router := route.router
+	return route.HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, err := router.Url(name, params...)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		http.Redirect(w, r, u, code)
+	})
+}
+
 // Url generates a URL for the route.
+// The values of parameters are validated by the conditions as they are,
+// and then escaped with url.PathEscape, so they can contain characters such as "/", "?" and "%".
+//
+// The value of a catch-all parameter {name...} is escaped segment by segment, keeping the slashes.
+// It can also be a slice of segments, and if the pattern ends with a catch-all parameter,
+// the values following it are segments too. The segments are joined with slashes
+// before they are validated by the conditions.
+// Otherwise, extra values are appended as path segments, unless the router is set to StrictUrlParams.
 func (route *Route) Url(params ...interface{}) (string, error) {
 	nParams := len(params)
 	nMatch := len(route.paramNamesMatch)
@@ -68,12 +553,26 @@ func (route *Route) Url(params ...interface{}) (string, error) {
 		return "", err
 	}
 
-	u := string(route.pattern)
-
+	values := make([]string, 0, nParams)
 	for i, v := range params {
-		s := fmt.Sprint(v)
+		if i < nMatch && route.paramNamesMatch[i][2] != "" {
+			values = append(values, catchAllValue(params[i:]))
+			break
+		}
+		values = append(values, fmt.Sprint(v))
+	}
+
+	if len(values) > nMatch && route.router.global.strictUrl {
+		err := fmt.Errorf("%w (%d > %d)",
+			ErrTooManyParameters, nParams, nMatch,
+		)
+		return "", err
+	}
+
+	u := string(route.pattern)
 
-		if (route.conditions[i] != nil) && !route.conditions[i](s) {
+	for i, s := range values {
+		if fn := route.conditions.get(i); (fn != nil) && !fn(s) {
 			err := fmt.Errorf("%w: %s not match the conditions",
 				ErrInvalidParameter, strconv.Quote(s),
 			)
@@ -82,15 +581,163 @@ func (route *Route) Url(params ...interface{}) (string, error) {
 
 		if i < nMatch {
 			m := route.paramNamesMatch[i]
-			u = strings.ReplaceAll(u, m[0], s)
+			if m[2] != "" {
+				if d, ok := route.defaults[i]; ok && s == d {
+					s = ""
+				}
+				u = strings.ReplaceAll(u, m[0], escapePath(s))
+			} else {
+				u = strings.ReplaceAll(u, m[0], url.PathEscape(s))
+			}
 		} else {
-			u += "/" + s
+			u += "/" + url.PathEscape(s)
 		}
 	}
 
 	return u, nil
 }
 
+// catchAllValue joins the values of a catch-all parameter with slashes.
+// Slices are expanded into their elements.
+func catchAllValue(params []interface{}) string {
+	segments := make([]string, 0, len(params))
+	for _, v := range params {
+		rv := reflect.ValueOf(v)
+		if rv.Kind() == reflect.Slice {
+			for i := 0; i < rv.Len(); i++ {
+				segments = append(segments, fmt.Sprint(rv.Index(i).Interface()))
+			}
+			continue
+		}
+		segments = append(segments, fmt.Sprint(v))
+	}
+	return strings.Join(segments, "/")
+}
+
+// ParseUrl extracts the named parameters from a path matching the pattern of the route,
+// e.g. to check that a URL generated by Url is parsed back to the same parameters.
+// The path is expected to be escaped, as returned by Url. The query string, if any, is ignored. The conditions of parameters are evaluated,
+// and the transforms are applied, as for the requests handled by the route.
+// It reports whether the path matches the route.
+func (route *Route) ParseUrl(path string) (Params, bool) {
+	path, _, _ = strings.Cut(path, "?")
+
+	m := route.router.Regexp(route.pattern.matchExpr()).FindStringSubmatch(path)
+	if m == nil {
+		return nil, false
+	}
+
+	params := make(httprouter.Params, len(m)-1)
+	for i, v := range m[1:] {
+		v, err := url.PathUnescape(strings.Trim(v, "/"))
+		if err != nil {
+			return nil, false
+		}
+		params[i].Value = v
+	}
+
+	if ok, _ := route.conditions.match(params); !ok {
+		return nil, false
+	}
+
+	return route.namedParams(params), true
+}
+
+// escapePath escapes the segments of a path, keeping the slashes between them.
+func escapePath(s string) string {
+	segments := strings.Split(s, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+func (route *Route) serve(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	if route.catchAll {
+		ctx := context.WithValue(r.Context(), matchedWildcardKey, true)
+		*r = *r.WithContext(ctx)
+	}
+
+	namedParams := route.namedParams(params)
+	for _, p := range ParamsFromRequest(r) {
+		// The parameters set by middleware with AddParam or SetParams follow the parameters of the path.
+		if _, ok := namedParams.lookup(p.Key); !ok {
+			namedParams = append(namedParams, p)
+		}
+	}
+	if len(namedParams) > 0 {
+		namedParams.toRequest(r)
+	}
+
+	if route.deprecated {
+		w.Header().Set("Deprecation", "true")
+		if !route.sunset.IsZero() {
+			w.Header().Set("Sunset", route.sunset.UTC().Format(http.TimeFormat))
+		}
+	}
+
+	if atomic.LoadInt32(&route.router.global.profiling) != 0 {
+		start := time.Now()
+		defer func() {
+			route.stats.add(time.Since(start))
+		}()
+	}
+
+	if route.wrapped != nil {
+		route.wrapped.ServeHTTP(w, r)
+		return
+	}
+
+	route.handle(w, r)
+}
+
+// handle calls the validators and the handler of the route.
+func (route *Route) handle(w http.ResponseWriter, r *http.Request) {
+	for _, fn := range route.validators {
+		if err := fn(r); err != nil {
+			route.router.global.handleInvalidRequest(w, r, err)
+			return
+		}
+	}
+
+	route.handler.ServeHTTP(w, r)
+}
+
+// use adds middleware functions of the route itself, such as the ones added with Router.UseForTag.
+// They wrap the validators and the handler, whatever handler is set.
+func (route *Route) use(middleware ...MiddlewareFunc) {
+	route.ownMiddleware = append(route.ownMiddleware.clone(), middleware...)
+	route.wrap()
+}
+
+func (route *Route) wrap() {
+	if len(route.ownMiddleware) == 0 {
+		route.wrapped = nil
+		return
+	}
+	route.wrapped = route.ownMiddleware.wrap(http.HandlerFunc(route.handle))
+}
+
+func (route *Route) clone() *Route {
+	clone := new(Route)
+	*clone = *route
+	clone.methods = append([]string(nil), route.methods...)
+	clone.conditions = route.conditions.clone()
+	clone.requestConditions = route.requestConditions.clone()
+	clone.transforms = route.transforms.clone()
+	if route.defaults != nil {
+		clone.defaults = make(map[int]string, len(route.defaults))
+		for i, v := range route.defaults {
+			clone.defaults[i] = v
+		}
+	}
+	clone.stats = new(routeStats)
+	clone.validators = append([]func(*http.Request) error(nil), route.validators...)
+	clone.wrap()
+
+	return clone
+}
+
 func (route *Route) namedParams(params httprouter.Params) Params {
 	n := len(params)
 	if n == 0 {
@@ -99,9 +746,13 @@ func (route *Route) namedParams(params httprouter.Params) Params {
 
 	named := make(Params, n)
 	for i, param := range params {
+		v := param.Value
+		if d, ok := route.defaults[i]; ok && v == "" {
+			v = d
+		}
 		named[i] = Param{
 			Key:   route.paramNames[i],
-			Value: param.Value,
+			Value: route.transforms.apply(i, v),
 		}
 	}
 
@@ -1,19 +1,139 @@
 package router
 
 import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+
 	"github.com/julienschmidt/httprouter"
 )
 
 type routeList []*Route
 
-func (routes *routeList) match(params httprouter.Params) *Route {
+// match returns the first route whose conditions are satisfied,
+// and the parameters split according to the pattern of the route.
+// The conditions of parameters are evaluated before the conditions of the request.
+// If r is nil, the conditions of the request are not evaluated.
+//
+// If no route matches, match returns the handler of the first failed condition
+// that has one, e.g. to respond with 415 Unsupported Media Type instead of 404 Not Found.
+func (routes *routeList) match(params httprouter.Params, r *http.Request) (*Route, httprouter.Params, http.Handler) {
+	return routes.matchRecording(params, r, nil)
+}
+
+// matchRecording is like match, and if misses is not nil and no route matches,
+// it sets it to the routes whose conditions failed, so that each condition is evaluated once.
+// The failures are kept on the stack until then, so the requests that match do not allocate for them.
+func (routes *routeList) matchRecording(params httprouter.Params, r *http.Request, misses *[]NearMiss) (*Route, httprouter.Params, http.Handler) {
+	var buf [4]missRef
+	failed := buf[:0]
+
+	var rejected http.Handler
 	for _, route := range *routes {
-		if route.handler == nil {
+		if route.handler == nil || route.Disabled() {
+			continue
+		}
+
+		split, ok := splitParams(params, route.splitters)
+		if !ok {
 			continue
 		}
-		if route.conditions.match(params) {
-			return route
+
+		i, onFail := route.conditions.failed(split)
+		if i < 0 {
+			ok, onFail = route.requestConditions.match(r)
+			if ok {
+				return route, split, nil
+			}
+		}
+		if misses != nil {
+			failed = append(failed, missRef{route: route, params: split, param: i})
+		}
+		if rejected == nil {
+			rejected = onFail
+		}
+	}
+
+	if misses != nil {
+		*misses = nearMisses(failed)
+	}
+	return nil, nil, rejected
+}
+
+// routeMatch is the result of matching the routes of a pattern against a request.
+type routeMatch struct {
+	routes   *routeList
+	route    *Route
+	params   httprouter.Params
+	rejected http.Handler
+	misses   []NearMiss
+}
+
+type routeMatchKeyType struct{}
+
+var routeMatchKey = routeMatchKeyType{}
+
+// resolve matches the routes against the request, with the parameters of httprouter
+// taken from params or, if it is nil, from the context of the request.
+// If the routes have already been matched against the request before the middleware functions,
+// which is the case for the patterns shared with routes skipping middleware, that result is returned.
+func (routes *routeList) resolve(params httprouter.Params, r *http.Request) routeMatch {
+	if m, ok := r.Context().Value(routeMatchKey).(*routeMatch); ok && m.routes == routes {
+		return *m
+	}
+
+	if params == nil {
+		params = httprouter.ParamsFromContext(r.Context())
+		for i, param := range params {
+			params[i].Value = strings.Trim(param.Value, "/")
+		}
+	}
+
+	m := routeMatch{routes: routes}
+	m.route, m.params, m.rejected = routes.matchRecording(params, r, &m.misses)
+	return m
+}
+
+// withMatch returns a shallow copy of the request carrying the result of matching,
+// so that the routes are not matched again after the middleware functions.
+func withMatch(r *http.Request, m routeMatch) *http.Request {
+	ctx := context.WithValue(r.Context(), routeMatchKey, &m)
+	return r.WithContext(ctx)
+}
+
+// add appends the route to the list, keeping the routes sorted by priority.
+func (routes *routeList) add(route *Route) {
+	*routes = append(*routes, route)
+	routes.sort()
+}
+
+// sort sorts the routes by priority in descending order.
+// Routes with the same priority remain in the order they have been added.
+func (routes *routeList) sort() {
+	sort.SliceStable(*routes, func(i, j int) bool {
+		return (*routes)[i].priority > (*routes)[j].priority
+	})
+}
+
+func (routes *routeList) skipsMiddleware() bool {
+	for _, route := range *routes {
+		if route.skipMiddleware {
+			return true
+		}
+	}
+	return false
+}
+
+func (routes *routeList) remove(route *Route) bool {
+	for i, r := range *routes {
+		if r == route {
+			a := make(routeList, 0, len(*routes)-1)
+			a = append(a, (*routes)[:i]...)
+			a = append(a, (*routes)[i+1:]...)
+			*routes = a
+			return true
 		}
 	}
-	return nil
+	return false
 }
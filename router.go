@@ -7,34 +7,63 @@
 //   - route prefixes and groups
 //   - middleware functions
 //   - validation of named parameters using regular expressions
+//   - several parameters in a path segment, e.g. {id}.{format}
 package router
 
 import (
+	"context"
 	"fmt"
 	"net/http"
+	"net/url"
 	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/julienschmidt/httprouter"
+
+	"github.com/olegshs/router/helpers"
 )
 
+var standardMethods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+	http.MethodConnect,
+	http.MethodOptions,
+	http.MethodTrace,
+}
+
 type Router struct {
-	prefix      pattern
-	conditions  conditions
-	middleware  middlewareList
-	routes      routeMap
-	routeByName map[string]*Route
-	r           *httprouter.Router
+	prefix              pattern
+	relaxedSlash        bool
+	conditions          conditions
+	inheritedConditions map[string]condition
+	middleware          middlewareList
+	tags                []string
+	requestConditions   requestConditions
+	unnamed             bool
+	routes              routeMap
+	handlers            map[*routeList]http.Handler
+	routeByName         map[string]*Route
+	global              *globalHandler
+	regexps             *regexpMap
+	r                   *httprouter.Router
 }
 
 // New creates a new instance of the router.
 func New() *Router {
 	router := new(Router)
 	router.prefix = ""
-	router.conditions = make(conditions)
+	router.conditions = make(conditions, 0)
 	router.middleware = make(middlewareList, 0)
 	router.routes = make(routeMap)
+	router.handlers = make(map[*routeList]http.Handler)
 	router.routeByName = make(map[string]*Route)
+	router.global = new(globalHandler)
+	router.regexps = newRegexpMap()
 	router.r = httprouter.New()
 	router.r.NotFound = http.NotFoundHandler()
 
@@ -42,6 +71,31 @@ func New() *Router {
 }
 
 // ParseMap adds routes defined in a map with a special structure (see example).
+//
+// Keys are interpreted in the following order of precedence:
+//   - a key starting with "$" is a keyword;
+//   - a key starting with a list of methods defines a route;
+//   - a key enclosed in parentheses, such as "(name)", defines a group;
+//   - any other key defines a prefix.
+//
+// Since a path such as "(v1)" would be treated as a group, groups and prefixes
+// can also be declared explicitly: the keyword $group takes a map (or a list of maps)
+// with the routes of the group, and the keyword $prefix takes a map (or a list of maps)
+// whose $path value specifies the prefix.
+//
+// The keywords $notfound and $methodnotallowed reference handlers by name
+// and are only allowed at the top level of the map.
+//
+// The keyword $where sets regular expressions for named parameters.
+// A parameter does not have to be specified in the current prefix: the condition is then
+// inherited by the routes of the block and its nested groups whose patterns contain the parameter,
+// unless the prefix of a nested block sets its own condition for it.
+//
+// The keyword $use adds middleware functions, referenced by name, to the block.
+// At the top level, they apply to all routes of the map, including the ones outside of any group or prefix.
+// Keywords are processed before the other keys of a block, whatever their order:
+// first $where and $use, then $notfound and $methodnotallowed, then $group and $prefix,
+// so the conditions and the middleware of a block apply to all of its handlers.
 func (router *Router) ParseMap(
 	m map[string]interface{},
 	handlerByName func(string) http.Handler,
@@ -55,19 +109,118 @@ func (router *Router) ParseMap(
 	p.ParseMap(m)
 }
 
+// ParseMapWith adds routes defined in a map, like ParseMap, looking up the handlers and the middleware functions
+// referenced by name in the maps, e.g. for static configurations.
+//
+// If any referenced names are missing from the maps, no routes are added, and a *ValidationError is returned
+// with an error for each of them, matching ErrMissingHandler or ErrMissingMiddleware.
+// A route without a name references the handler "".
+// Malformed maps still cause panics, as with ParseMap.
+func (router *Router) ParseMapWith(
+	m map[string]interface{},
+	handlers map[string]http.Handler,
+	middlewares map[string]MiddlewareFunc,
+) error {
+	var errs []error
+	missing := make(map[string]bool)
+	report := func(kind string, name string, err error) {
+		if !missing[kind+name] {
+			missing[kind+name] = true
+			errs = append(errs, fmt.Errorf("%q: %w", name, err))
+		}
+	}
+
+	// The map is parsed by a separate router first, so that nothing is added if a name is missing.
+	New().ParseMap(m,
+		func(name string) http.Handler {
+			if _, ok := handlers[name]; !ok {
+				report("handler", name, ErrMissingHandler)
+			}
+			return nil
+		},
+		func(name string) MiddlewareFunc {
+			if _, ok := middlewares[name]; !ok {
+				report("middleware", name, ErrMissingMiddleware)
+			}
+			return nil
+		},
+	)
+	if len(errs) > 0 {
+		return &ValidationError{Errors: errs}
+	}
+
+	router.ParseMap(m,
+		func(name string) http.Handler {
+			return handlers[name]
+		},
+		func(name string) MiddlewareFunc {
+			return middlewares[name]
+		},
+	)
+	return nil
+}
+
 // Group adds a group of routes.
 // Middleware functions can be specified for the group.
 func (router *Router) Group(f func(*Router)) {
 	f(router.clone())
 }
 
+// When adds a group of routes only if enabled is true, e.g. for feature-flagged endpoints.
+// Otherwise f is not called.
+func (router *Router) When(enabled bool, f func(*Router)) {
+	if enabled {
+		router.Group(f)
+	}
+}
+
 // Prefix adds a group of routes with a specified prefix.
 // The prefix can contain named parameters.
+//
+// The paths of the routes in the group are appended to the prefix as is:
+// with the prefix "/users", the path "" results in "/users", "/" in "/users/",
+// and "/{id}" in "/users/{id}". If the prefix ends with a slash, and the path starts with one,
+// the slash is not duplicated. An empty pattern outside of any prefix is treated as "/".
 func (router *Router) Prefix(path string, f func(*Router)) {
 	sub := router.clone()
-	sub.prefix = router.prefix + pattern(path)
+	sub.prefix = router.prefix.join(path)
 
 	f(sub)
+
+	global := router.global
+	global.prefixes = append(global.prefixes, prefixMiddleware{
+		pattern:    sub.prefix,
+		middleware: sub.middleware,
+	})
+
+	if global.prefixed {
+		global.sortPrefixes()
+	}
+}
+
+// NotFoundWithPrefixMiddleware sets whether the handler set with HandleNotFound is wrapped
+// in the middleware functions of the deepest group created with Prefix whose prefix contains the path,
+// instead of the middleware of the router it has been set on, so that unmatched requests within a subtree,
+// such as "/admin/missing", pass through the same middleware as its routes.
+//
+// The middleware of a group is the one it has when its Prefix closure returns,
+// including the middleware inherited from outer groups. The prefixes are matched as with NotFoundHere,
+// whose handlers take precedence. The paths outside of any prefix are handled as before.
+func (router *Router) NotFoundWithPrefixMiddleware(enabled bool) {
+	router.global.prefixed = enabled
+	if enabled {
+		router.global.sortPrefixes()
+	}
+	router.global.installDispatch(router.r)
+}
+
+// RelaxTrailingSlash sets whether the routes subsequently created by the router or by a group of routes
+// should match paths both with and without a trailing slash, instead of redirecting to the canonical one.
+// It allows, for example, an API prefix to tolerate trailing slashes while the rest of the routes redirect them.
+// Routes with catch-all parameters are not affected, as well as patterns that already have
+// a route registered for the other variant. A route added later for the other variant takes it over.
+func (router *Router) RelaxTrailingSlash(relaxed bool) {
+	router.relaxedSlash = relaxed
 }
 
 // Use adds middleware functions that will be used by the router or by a group of routes.
@@ -75,21 +228,68 @@ func (router *Router) Use(middleware ...MiddlewareFunc) {
 	router.middleware = append(router.middleware, middleware...)
 }
 
+// UseGlobal adds middleware functions that wrap the entire router.
+//
+// Unlike the middleware added with Use, which wraps the handlers of matched routes,
+// these functions run for every request before routing, including requests
+// that end up with 404 Not Found or 405 Method Not Allowed.
+// They apply to the whole router regardless of the group UseGlobal is called in,
+// and run in the order they have been added, before any other middleware.
+// Panics in these functions are also passed to the handler set with HandlePanic.
+func (router *Router) UseGlobal(middleware ...MiddlewareFunc) {
+	router.global.middleware = append(router.global.middleware, middleware...)
+	router.buildGlobalHandler()
+}
+
 // Where sets a regular expression for validating the named parameter specified in a prefix.
+// It applies to the routes created by the router or by its groups afterwards;
+// the routes created before keep the conditions they have been created with.
 func (router *Router) Where(param string, regexp *regexp.Regexp) {
-	router.WhereFunc(param, func(v string) bool {
-		return regexp.MatchString(v)
+	router.where(param, condition{
+		match:   regexp.MatchString,
+		pattern: regexp.String(),
 	})
 }
 
 // WhereFunc sets a function for validating the named parameter specified in a prefix.
+// Like Where, it does not affect the routes created before.
 func (router *Router) WhereFunc(param string, matchFunc func(string) bool) {
+	router.where(param, condition{
+		match: matchFunc,
+	})
+}
+
+func (router *Router) where(param string, cond condition) {
 	i := router.prefix.paramNames().IndexOf(param)
 	if i < 0 {
 		panic("unknown parameter: " + param)
 	}
 
-	router.conditions[i] = matchFunc
+	router.conditions.set(i, cond)
+}
+
+// inheritWhere sets a condition for the parameter in the routes added later to the router and its groups,
+// whose patterns contain the parameter. Unlike where, the prefix does not have to contain it.
+func (router *Router) inheritWhere(param string, cond condition) {
+	if i := router.prefix.paramNames().IndexOf(param); i >= 0 {
+		router.conditions.set(i, cond)
+		return
+	}
+
+	inherited := make(map[string]condition, len(router.inheritedConditions)+1)
+	for k, v := range router.inheritedConditions {
+		inherited[k] = v
+	}
+	inherited[param] = cond
+	router.inheritedConditions = inherited
+}
+
+// Regexp returns a compiled regular expression from a cache shared by the router and its groups,
+// so that the same expression used by many routes is compiled only once.
+// It panics if the expression cannot be parsed, like regexp.MustCompile.
+// It is safe for concurrent use.
+func (router *Router) Regexp(expr string) *regexp.Regexp {
+	return router.regexps.Get(expr)
 }
 
 // Get creates and returns a route for handling GET requests.
@@ -122,21 +322,144 @@ func (router *Router) Options(path string) *Route {
 	return router.NewRoute(path, http.MethodOptions)
 }
 
+// Except creates and returns a route for handling requests sent with any standard method
+// except the specified ones. Requests sent with the excluded methods get 405 Method Not Allowed,
+// unless other routes handle them.
+// If OPTIONS is not excluded, automatic responses to OPTIONS requests are disabled for the path.
+// Like any other route, it has a single pattern, so Url works regardless of the methods.
+func (router *Router) Except(path string, excluded ...string) *Route {
+	methods := make([]string, 0, len(standardMethods))
+	for _, method := range standardMethods {
+		if helpers.Slice[string](excluded).IndexOf(method) < 0 {
+			methods = append(methods, method)
+		}
+	}
+
+	return router.NewRoute(path, methods...)
+}
+
+// Handle mounts a handler at the prefix, so that it handles all requests for the paths under the prefix,
+// sent with any standard method, e.g. http.DefaultServeMux for /debug/pprof.
+// The handler is wrapped in the middleware functions of the router.
+// If stripPrefix is true, the handler receives requests with the prefix removed from the path,
+// like with http.StripPrefix; the prefix can contain named parameters in this case as well.
+// The prefix itself without a trailing slash is redirected to the prefix with one.
+func (router *Router) Handle(prefix string, handler http.Handler, stripPrefix bool) *Route {
+	route := router.NewRoute(strings.TrimSuffix(prefix, "/")+"/{path...}", standardMethods...)
+
+	if !stripPrefix {
+		return route.Handle(handler)
+	}
+
+	n := len(route.paramNames)
+
+	return route.HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := "/" + ParamsFromRequest(r)[n-1].Value
+		if path != "/" && strings.HasSuffix(r.URL.Path, "/") {
+			// The trailing slash is trimmed from the parameter, but is significant, e.g. for http.FileServer.
+			path += "/"
+		}
+
+		r2 := new(http.Request)
+		*r2 = *r
+		r2.URL = new(url.URL)
+		*r2.URL = *r.URL
+		r2.URL.Path = path
+		r2.URL.RawPath = ""
+
+		handler.ServeHTTP(w, r2)
+	})
+}
+
 // NewRoute creates and returns a route for handling requests sent with the specified methods.
+// The route gets a copy of the conditions set for the prefix at the time it is created,
+// so the conditions set for the route afterwards do not affect the router or other routes, and vice versa.
 func (router *Router) NewRoute(path string, methods ...string) *Route {
 	route := new(Route)
 	route.router = router
 	route.methods = methods
-	route.pattern = router.prefix + pattern(path)
+	route.pattern = router.prefix.join(path).routePattern()
 	route.paramNames = route.pattern.paramNames()
 	route.paramNamesMatch = route.pattern.paramNamesMatch()
+	route.splitters = route.pattern.splitters()
+	route.catchAll = route.pattern.hasCatchAll()
 	route.conditions = router.conditions.clone()
+	route.requestConditions = router.requestConditions.clone()
+	route.tags = router.tags
+	for _, tag := range route.tags {
+		route.useForTag(tag)
+	}
+	route.stats = new(routeStats)
+
+	for param, cond := range router.inheritedConditions {
+		i := route.paramNames.IndexOf(param)
+		if i >= 0 && route.conditions.get(i) == nil {
+			route.conditions.set(i, cond)
+		}
+	}
 
 	router.addRoute(route)
 
 	return route
 }
 
+// RemoveRoute removes the routes with the specified pattern for the method.
+// The pattern is relative to the prefix of the router, as in NewRoute.
+// It reports whether any routes have been removed.
+//
+// Since httprouter does not support removing routes, the path remains registered in it,
+// and requests are dispatched to the remaining routes with the same pattern, if any,
+// or to the NotFound handler.
+// RemoveRoute must not be called while the router is serving requests;
+// use Route.Disable and Route.Enable instead.
+func (router *Router) RemoveRoute(method string, path string) bool {
+	pattern := router.prefix.join(path).routePattern()
+
+	routes, ok := router.routes[method][pattern.httpRouterString()]
+	if !ok {
+		return false
+	}
+
+	removed := false
+	for _, route := range *routes {
+		if route.pattern != pattern {
+			continue
+		}
+
+		routes.remove(route)
+		route.methods = helpers.Slice[string](route.methods).Remove(method)
+		if len(route.methods) == 0 {
+			for name, r := range router.routeByName {
+				if r == route {
+					delete(router.routeByName, name)
+					router.renameSibling(route)
+				}
+			}
+		}
+
+		removed = true
+	}
+
+	return removed
+}
+
+// renameSibling makes the name of a removed route refer to another route with the same name and pattern, if any.
+func (router *Router) renameSibling(removed *Route) {
+	for _, route := range router.Routes() {
+		if route != removed && route.name == removed.name && route.pattern == removed.pattern {
+			router.routeByName[route.name] = route
+			return
+		}
+	}
+}
+
+// StrictUrlParams sets whether Url returns ErrTooManyParameters when it gets more values
+// than the parameters of the route. By default, the extra values are appended to the URL as path segments.
+// The setting applies to all routes of the router.
+func (router *Router) StrictUrlParams(strict bool) {
+	router.global.strictUrl = strict
+}
+
 // Url generates a URL for a named route.
 func (router *Router) Url(name string, params ...interface{}) (string, error) {
 	route, ok := router.routeByName[name]
@@ -152,79 +475,502 @@ func (router *Router) Url(name string, params ...interface{}) (string, error) {
 	return u, nil
 }
 
+// UrlForMethod generates a URL for a named route handling the method,
+// for the names given to routes with different patterns for different methods, e.g. in legacy APIs.
+// If the route used by Url handles the method, the result is the same as of Url.
+// Otherwise, the first route with the name handling the method is used, in the order of Routes.
+// Router.Validate still reports such names with ErrDuplicateName, since Url cannot tell the routes apart.
+func (router *Router) UrlForMethod(name string, method string, params ...interface{}) (string, error) {
+	route, ok := router.routeByName[name]
+	if !ok || !hasMethod(route.methods, method) {
+		route = nil
+		for _, r := range router.Routes() {
+			if r.name == name && hasMethod(r.methods, method) {
+				route = r
+				break
+			}
+		}
+	}
+	if route == nil {
+		return "", fmt.Errorf("%s %s: %w", method, name, ErrRouteNotFound)
+	}
+
+	u, err := route.Url(params...)
+	if err != nil {
+		return "", fmt.Errorf("%s %s: %w", method, name, err)
+	}
+
+	return u, nil
+}
+
+// GenerateUrls generates URLs for all named routes, e.g. for a sitemap or for testing link generation.
+// The sample function returns a value for each named parameter of a route.
+// The result maps the names of the routes to their URLs.
+//
+// Routes whose conditions reject the sample values are omitted from the result,
+// and the errors are returned together as a *ValidationError.
+func (router *Router) GenerateUrls(sample func(routeName string, paramName string) interface{}) (map[string]string, error) {
+	var errs []error
+
+	names := helpers.Map[string, *Route](router.routeByName).SortedKeys()
+	urls := make(map[string]string, len(names))
+
+	for _, name := range names {
+		route := router.routeByName[name]
+
+		params := make([]interface{}, len(route.paramNames))
+		for i, param := range route.paramNames {
+			params[i] = sample(name, param)
+		}
+
+		u, err := route.Url(params...)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+
+		urls[name] = u
+	}
+
+	if len(errs) > 0 {
+		return urls, &ValidationError{Errors: errs}
+	}
+
+	return urls, nil
+}
+
+// UrlRequest is a named route and the values of its parameters, for generating its URL with Router.Urls.
+type UrlRequest struct {
+	Name   string
+	Params []interface{}
+}
+
+// Urls generates the URLs of several named routes in one call, e.g. for the links of a navigation menu.
+// The URLs are in the order of the requests.
+//
+// It does not fail fast: all URLs are generated, and the ones that cannot be are left empty.
+// The errors are then returned together as a *ValidationError, each starting with the position of its request.
+func (router *Router) Urls(requests []UrlRequest) ([]string, error) {
+	var errs []error
+	urls := make([]string, len(requests))
+
+	for i, req := range requests {
+		u, err := router.Url(req.Name, req.Params...)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%d: %w", i, err))
+			continue
+		}
+
+		urls[i] = u
+	}
+
+	if len(errs) > 0 {
+		return urls, &ValidationError{Errors: errs}
+	}
+
+	return urls, nil
+}
+
+// AllowedMethods returns a sorted list of methods of the routes matching the path.
+// The conditions of parameters are taken into account, the conditions of requests are not.
+// With AutoHead, HEAD is included along with GET.
+func (router *Router) AllowedMethods(path string) []string {
+	methods := make([]string, 0)
+	for method := range router.routes {
+		routes, params := router.lookup(method, path)
+		if routes == nil {
+			continue
+		}
+		if route, _, _ := routes.match(params, nil); route != nil {
+			methods = append(methods, method)
+		}
+	}
+
+	if router.global.autoHead && !hasMethod(methods, http.MethodHead) && hasMethod(methods, http.MethodGet) {
+		methods = append(methods, http.MethodHead)
+	}
+
+	sort.Strings(methods)
+	return methods
+}
+
 // HandleNotFound sets a handler that is called when a route is not found.
 func (router *Router) HandleNotFound(handler http.Handler) {
-	router.r.NotFound = router.middleware.wrap(handler)
+	router.global.notFoundRaw = handler
+	handler = router.middleware.wrap(handler)
+
+	if router.global.dispatching {
+		router.global.notFound = handler
+		return
+	}
+
+	router.r.NotFound = handler
+}
+
+// NotFoundHere sets a handler that is called when a route is not found
+// for a path starting with the prefix of the router, e.g. inside a Prefix closure,
+// so that a subtree such as "/api" can respond with its own 404 pages.
+// The handler is wrapped in the middleware functions added to the router so far.
+//
+// The handler is only called when no route matches the path, so it never shadows the routes
+// of the subtree, and a path matching a route with other methods still gets 405 Method Not Allowed.
+// If the subtrees of several calls contain the path, the deepest one is used.
+// Other paths are handled by the handler set with HandleNotFound.
+//
+// Since httprouter does not allow a catch-all parameter next to other routes in the same segment,
+// the handler is not registered as a route with {path...}, and the prefix is matched separately.
+func (router *Router) NotFoundHere(handler http.Handler) {
+	global := router.global
+	global.installDispatch(router.r)
+
+	global.subtrees = append(global.subtrees, subtreeHandler{
+		prefix:  router.prefix.prefixRegexp(),
+		depth:   strings.Count(string(router.prefix.routePattern()), "/"),
+		handler: router.middleware.wrap(handler),
+	})
+
+	sort.SliceStable(global.subtrees, func(i, j int) bool {
+		return global.subtrees[i].depth > global.subtrees[j].depth
+	})
+}
+
+// Fallback sets a handler that is called when no route matches the request,
+// including the case when a route with the matching pattern rejects the request by its conditions.
+// It never shadows the routes, regardless of the order of registration.
+// The handler is wrapped in the middleware functions of the router,
+// and receives the requested path without the leading slash as the parameter "path".
+// It replaces the handler set with HandleNotFound.
+func (router *Router) Fallback(handler http.Handler) {
+	router.HandleNotFound(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		params := Params{{Key: "path", Value: strings.TrimPrefix(r.URL.Path, "/")}}
+		params.toRequest(r)
+
+		handler.ServeHTTP(w, r)
+	}))
 }
 
 // HandleMethodNotAllowed sets a handler that is called when the route is found,
 // but the request method is not supported.
 func (router *Router) HandleMethodNotAllowed(handler http.Handler) {
-	router.r.MethodNotAllowed = router.middleware.wrap(handler)
+	handler = router.middleware.wrap(handler)
+
+	if router.global.dispatching {
+		router.global.notAllowed = handler
+		return
+	}
+
+	router.r.MethodNotAllowed = handler
 }
 
 // HandlePanic sets a panic handler for the router.
 // The handler receives http.ResponseWriter, *http.Request,
 // and the value returned by the recover function.
+// It replaces the handlers added with UsePanicHandler.
 func (router *Router) HandlePanic(handler func(http.ResponseWriter, *http.Request, interface{})) {
-	router.r.PanicHandler = handler
+	router.global.panicHandlers = nil
+	router.UsePanicHandler(handler)
+}
+
+// UsePanicHandler adds panic handlers to the router, e.g. one that logs panics (see PanicLogger)
+// and one that responds to the client. The handlers are called in the order they have been added,
+// and receive the same arguments as the handler set with HandlePanic.
+// Only one of them should write the response; the others should only observe the panic.
+func (router *Router) UsePanicHandler(handlers ...func(http.ResponseWriter, *http.Request, interface{})) {
+	for _, handler := range handlers {
+		if handler != nil {
+			router.global.panicHandlers = append(router.global.panicHandlers, handler)
+		}
+	}
+
+	if len(router.global.panicHandlers) > 0 {
+		router.r.PanicHandler = router.global.handlePanic
+	} else {
+		router.r.PanicHandler = nil
+	}
 }
 
 // ServeHTTP implements the http.Handler interface.
 func (router *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	router.r.ServeHTTP(w, r)
+	if router.global.handler == nil {
+		router.r.ServeHTTP(w, r)
+		return
+	}
+
+	if router.r.PanicHandler != nil {
+		defer func() {
+			if rcv := recover(); rcv != nil {
+				router.r.PanicHandler(w, r, rcv)
+			}
+		}()
+	}
+
+	router.global.handler.ServeHTTP(w, r)
 }
 
 func (router *Router) clone() *Router {
 	clone := new(Router)
 	clone.prefix = router.prefix
+	clone.relaxedSlash = router.relaxedSlash
 	clone.conditions = router.conditions.clone()
+	clone.inheritedConditions = router.inheritedConditions
 	clone.middleware = router.middleware.clone()
+	clone.tags = router.tags
+	clone.requestConditions = router.requestConditions
+	clone.unnamed = router.unnamed
 	clone.routes = router.routes
+	clone.handlers = router.handlers
 	clone.routeByName = router.routeByName
+	clone.global = router.global
+	clone.regexps = router.regexps
 	clone.r = router.r
 
 	return clone
 }
 
+// DeepClone creates an independent copy of the router with all its routes,
+// so that changes made to the copy do not affect the original, and vice versa.
+// The handlers and middleware functions themselves are shared.
+//
+// Since httprouter.Router cannot be copied, the copy gets a new instance of it
+// with the same settings, and the routes are registered in it again,
+// preserving their order and middleware.
+func (router *Router) DeepClone() *Router {
+	routes := make(routeMap)
+	handlers := make(map[*routeList]http.Handler)
+	routeByName := make(map[string]*Route, len(router.routeByName))
+
+	r := httprouter.New()
+	r.RedirectTrailingSlash = router.r.RedirectTrailingSlash
+	r.RedirectFixedPath = router.r.RedirectFixedPath
+	r.HandleMethodNotAllowed = router.r.HandleMethodNotAllowed
+	r.HandleOPTIONS = router.r.HandleOPTIONS
+	r.GlobalOPTIONS = router.r.GlobalOPTIONS
+	r.NotFound = router.r.NotFound
+	r.MethodNotAllowed = router.r.MethodNotAllowed
+
+	global := router.global.clone()
+	if global.dispatching {
+		global.r = r
+		r.NotFound = http.HandlerFunc(global.serveNotFound)
+		r.MethodNotAllowed = http.HandlerFunc(global.serveMethodNotAllowed)
+	}
+	if len(global.panicHandlers) > 0 {
+		r.PanicHandler = global.handlePanic
+	}
+
+	subs := make(map[*Router]*Router)
+	sub := func(orig *Router) *Router {
+		if _, ok := subs[orig]; !ok {
+			clone := orig.clone()
+			clone.routes = routes
+			clone.handlers = handlers
+			clone.routeByName = routeByName
+			clone.global = global
+			clone.regexps = orig.regexps
+			clone.r = r
+			subs[orig] = clone
+		}
+		return subs[orig]
+	}
+
+	copies := make(map[*Route]*Route)
+	copyRoute := func(orig *Route) *Route {
+		if _, ok := copies[orig]; !ok {
+			clone := orig.clone()
+			clone.router = sub(orig.router)
+			copies[orig] = clone
+		}
+		return copies[orig]
+	}
+
+	// The trailing slash variants of relaxed routes share the lists of the routes.
+	lists := make(map[*routeList]*routeList)
+
+	for method, m := range router.routes {
+		for p, a := range m {
+			if list, ok := lists[a]; ok {
+				routes[method][p] = list
+				if len(*list) > 0 {
+					r.Handle(method, p, routesHandle(list, handlers[list]))
+				}
+				continue
+			}
+
+			list := routes.get(method, p)
+			lists[a] = list
+			for _, route := range *a {
+				*list = append(*list, copyRoute(route))
+			}
+
+			if len(*list) > 0 {
+				// The handler is wrapped in the middleware the routes have been registered with.
+				h := (*list)[0].router.newHandler(list, (*a)[0].middleware)
+				handlers[list] = h
+				if router.global.wildcard(method, p) != nil {
+					sub(router).addWildcard(method, p, list, h)
+				} else {
+					r.Handle(method, p, routesHandle(list, h))
+				}
+			}
+		}
+	}
+
+	for name, route := range router.routeByName {
+		routeByName[name] = copyRoute(route)
+	}
+
+	clone := sub(router)
+	clone.buildGlobalHandler()
+
+	return clone
+}
+
 func (router *Router) addRoute(route *Route) {
 	p := route.pattern.httpRouterString()
 
-	for _, method := range route.methods {
+	for i, method := range route.methods {
+		if a, ok := router.routes[method][p]; ok && len(*a) > 0 && (*a)[0].pattern.httpRouterString() != p {
+			// The pattern is the trailing slash variant of a relaxed route (see RelaxTrailingSlash),
+			// which an explicit route takes over with its own list of routes.
+			delete(router.routes[method], p)
+			router.rebuild()
+		}
+
 		a := router.routes.get(method, p)
 
 		if len(*a) == 0 {
-			h := router.newHandler(a)
-			router.r.Handler(method, p, h)
+			h := router.newHandler(a, router.middleware)
+			router.handlers[a] = h
+			router.register(method, route, p, a, h)
+
+			if router.relaxedSlash {
+				router.addTrailingSlashVariant(method, p, a, h)
+			}
+
+			if i == 0 {
+				route.middleware = router.middleware.clone()
+			}
+		} else if i == 0 {
+			// The routes with the same pattern share the middleware of the router that added the first of them.
+			route.middleware = (*a)[0].middleware
 		}
 
-		*a = append(*a, route)
+		a.add(route)
 	}
 }
 
-func (router *Router) newHandler(routes *routeList) http.Handler {
-	var handler http.Handler
-	handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		params := httprouter.ParamsFromContext(r.Context())
+// addTrailingSlashVariant registers the handler for the pattern with or without a trailing slash,
+// unless such a pattern has already been registered.
+func (router *Router) addTrailingSlashVariant(method string, p string, routes *routeList, h http.Handler) {
+	if p == "/" || strings.Contains(p, "*") {
+		return
+	}
+
+	var variant string
+	if strings.HasSuffix(p, "/") {
+		variant = p[:len(p)-1]
+	} else {
+		variant = p + "/"
+	}
+
+	if _, ok := router.routes[method][variant]; ok {
+		return
+	}
+
+	router.routes[method][variant] = routes
+	router.r.Handle(method, variant, routesHandle(routes, h))
+}
+
+// routesHandle returns the handle of the routes registered in httprouter.
+// Like httprouter.Router.Handler, it passes the parameters to the handler in the context of the request.
+// Called with a routesProbe as the writer, it reports the routes instead of serving the request.
+func routesHandle(routes *routeList, h http.Handler) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+		if probe, ok := w.(*routesProbe); ok {
+			probe.routes = routes
+			return
+		}
+
+		if len(params) > 0 {
+			ctx := context.WithValue(r.Context(), httprouter.ParamsKey, params)
+			r = r.WithContext(ctx)
+		}
+		h.ServeHTTP(w, r)
+	}
+}
+
+// routesProbe is passed by lookup to a handle found by httprouter to learn its routes,
+// since httprouter.Router.Lookup does not report the pattern it has matched. It is never written to.
+type routesProbe struct {
+	http.ResponseWriter
+	routes *routeList
+}
+
+// lookup returns the list of routes registered for the method whose pattern matches the path,
+// and the parameters extracted from the path.
+// The path is matched by httprouter, as for requests, so it takes the same time regardless of the number of routes.
+func (router *Router) lookup(method string, path string) (*routeList, httprouter.Params) {
+	handle, params, _ := router.r.Lookup(method, path)
+	if handle == nil {
+		wildcard, params := router.global.matchWildcard(method, path)
+		if wildcard == nil {
+			return nil, nil
+		}
+
 		for i, param := range params {
 			params[i].Value = strings.Trim(param.Value, "/")
 		}
+		return wildcard.routes, params
+	}
+
+	probe := new(routesProbe)
+	handle(probe, nil, params)
+	if probe.routes == nil {
+		return nil, nil
+	}
+
+	for i, param := range params {
+		params[i].Value = strings.Trim(param.Value, "/")
+	}
+	return probe.routes, params
+}
+
+// newHandler returns the handler of the routes, wrapped in the middleware functions.
+//
+// If any of the routes skips middleware, the routes are matched before the middleware functions,
+// and the result is carried in the context of the request, so that they are matched once.
+func (router *Router) newHandler(routes *routeList, middleware middlewareList) http.Handler {
+	var handler http.Handler
+	handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m := routes.resolve(nil, r)
+		if m.route == nil {
+			r = withNearMisses(r, m.misses)
+			if m.rejected != nil {
+				m.rejected.ServeHTTP(w, r)
+				return
+			}
 
-		route := routes.match(params)
-		if route == nil {
 			router.r.NotFound.ServeHTTP(w, r)
 			return
 		}
 
-		namedParams := route.namedParams(params)
-		if len(namedParams) > 0 {
-			namedParams.toRequest(r)
-		}
-
-		route.handler.ServeHTTP(w, r)
+		m.route.serve(w, r, m.params)
 	})
 
-	handler = router.middleware.wrap(handler)
+	handler = middleware.wrap(handler)
 
-	return handler
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !routes.skipsMiddleware() {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		m := routes.resolve(nil, r)
+		if m.route != nil && m.route.skipMiddleware {
+			m.route.serve(w, r, m.params)
+			return
+		}
+
+		handler.ServeHTTP(w, withMatch(r, m))
+	})
 }
@@ -1,17 +1,30 @@
 package router
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"log"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/olegshs/router/routertest"
 )
 
 func ExampleRouter_ParseMap() {
@@ -141,6 +154,29 @@ func ExampleRouter_HandlePanic() {
 	})
 }
 
+func ExampleMaxBodySize() {
+	r := DefaultRouter()
+
+	r.Prefix("/api", func(r *Router) {
+		r.Use(MaxBodySize(1 << 20))
+
+		r.Post("/articles").
+			HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+				err := r.ParseForm()
+				if errors.Is(err, ErrRequestBodyTooLarge) {
+					http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+					return
+				}
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+
+				fmt.Fprintf(w, "Create article %q\n", r.Form.Get("title"))
+			})
+	})
+}
+
 func TestRouter_ParseMap(t *testing.T) {
 	r := New()
 
@@ -218,6 +254,382 @@ func TestRouter_ParseMap(t *testing.T) {
 	}
 }
 
+func TestRouter_ParseMap_notFound(t *testing.T) {
+	r := New()
+
+	handlerByName := func(name string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch name {
+			case "errors.notFound":
+				w.WriteHeader(http.StatusNotFound)
+			case "errors.methodNotAllowed":
+				w.WriteHeader(http.StatusMethodNotAllowed)
+			}
+			fmt.Fprintf(w, "route: %s\n", name)
+		})
+	}
+
+	r.ParseMap(
+		map[string]interface{}{
+			"$notfound":         "errors.notFound",
+			"$methodnotallowed": "errors.methodNotAllowed",
+			"GET /test":         "pages.test",
+		},
+		handlerByName,
+		nil,
+	)
+
+	{
+		resp := testRequest(r, http.MethodGet, "/missing", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusNotFound)
+		assertBody(t, resp.Body, "route: errors.notFound\n")
+	}
+	{
+		resp := testRequest(r, http.MethodPost, "/test", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusMethodNotAllowed)
+		assertBody(t, resp.Body, "route: errors.methodNotAllowed\n")
+	}
+
+	for _, k := range []string{"$notfound", "$methodnotallowed"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: nested keyword did not panic", k)
+				}
+			}()
+
+			New().ParseMap(
+				map[string]interface{}{
+					"/api": map[string]interface{}{
+						k: "errors.notFound",
+					},
+				},
+				handlerByName,
+				nil,
+			)
+		}()
+	}
+}
+
+func TestRouter_ParseMap_explicit(t *testing.T) {
+	r := New()
+
+	r.ParseMap(
+		map[string]interface{}{
+			"$group": map[string]interface{}{
+				"$use":      "test",
+				"GET /test": "pages.test",
+			},
+			"$prefix": []interface{}{
+				map[string]interface{}{
+					"$path": "/(v1)",
+					"GET":   "v1.index",
+				},
+				map[string]interface{}{
+					"$path":  "/v2",
+					"GET /a": "v2.a",
+				},
+			},
+		},
+		func(routeName string) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprintf(w, "route: %s\n", routeName)
+			})
+		},
+		func(middlewareName string) MiddlewareFunc {
+			return func(next http.Handler) http.Handler {
+				return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Header().Set("X-Test", middlewareName)
+					next.ServeHTTP(w, r)
+				})
+			}
+		},
+	)
+
+	{
+		resp := testRequest(r, http.MethodGet, "/test", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+		assertHeader(t, resp.Header, "X-Test", "test")
+		assertBody(t, resp.Body, "route: pages.test\n")
+	}
+	{
+		resp := testRequest(r, http.MethodGet, "/(v1)", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+		assertHeaderMissing(t, resp.Header, "X-Test")
+		assertBody(t, resp.Body, "route: v1.index\n")
+	}
+	{
+		resp := testRequest(r, http.MethodGet, "/v2/a", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+		assertBody(t, resp.Body, "route: v2.a\n")
+	}
+}
+
+func TestRouter_ParseMap_inheritedWhere(t *testing.T) {
+	r := New()
+
+	r.ParseMap(
+		map[string]interface{}{
+			"/api": map[string]interface{}{
+				"$where": map[string]interface{}{
+					"id": `^\d+$`,
+				},
+				"GET /articles/{id}": "articles.get",
+				"/users": map[string]interface{}{
+					"GET /{id}": "users.get",
+				},
+				"/tags/{id}": map[string]interface{}{
+					"$where": map[string]interface{}{
+						"id": `^[a-z]+$`,
+					},
+					"GET": "tags.get",
+				},
+				"GET /pages/{id}": map[string]interface{}{
+					"$name": "pages.get",
+					"id":    `^[a-z]+$`,
+				},
+			},
+		},
+		func(routeName string) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprintf(w, "route: %s\n", routeName)
+			})
+		},
+		nil,
+	)
+
+	a := []struct {
+		path   string
+		status int
+	}{
+		{"/api/articles/111", http.StatusOK},
+		{"/api/articles/abc", http.StatusNotFound},
+		{"/api/users/111", http.StatusOK},
+		{"/api/users/abc", http.StatusNotFound},
+		{"/api/tags/abc", http.StatusOK},
+		{"/api/tags/111", http.StatusNotFound},
+		{"/api/pages/abc", http.StatusOK},
+		{"/api/pages/111", http.StatusNotFound},
+	}
+	for _, v := range a {
+		resp := testRequest(r, http.MethodGet, v.path, nil, nil)
+		assertStatus(t, resp.StatusCode, v.status)
+	}
+}
+
+func TestRouter_ParseMap_inheritedWhereExplicit(t *testing.T) {
+	r := New()
+
+	r.ParseMap(
+		map[string]interface{}{
+			"$where": map[string]interface{}{
+				"id": `^\d+$`,
+			},
+			"$group": map[string]interface{}{
+				"GET /articles/{id}": "articles.get",
+			},
+			"$prefix": map[string]interface{}{
+				"$path":     "/users",
+				"GET /{id}": "users.get",
+			},
+		},
+		func(routeName string) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprintf(w, "route: %s\n", routeName)
+			})
+		},
+		nil,
+	)
+
+	a := []struct {
+		path   string
+		status int
+	}{
+		{"/articles/111", http.StatusOK},
+		{"/articles/abc", http.StatusNotFound},
+		{"/users/111", http.StatusOK},
+		{"/users/abc", http.StatusNotFound},
+	}
+	for _, v := range a {
+		resp := testRequest(r, http.MethodGet, v.path, nil, nil)
+		assertStatus(t, resp.StatusCode, v.status)
+	}
+}
+
+func TestRouter_ParseMap_whitespace(t *testing.T) {
+	r := New()
+
+	r.ParseMap(
+		map[string]interface{}{
+			"GET  /x":         "x",
+			" GET ,POST\t/y ": "y",
+			"GET /with space": "space",
+			"/prefix": map[string]interface{}{
+				"GET":          "prefix.index",
+				"PUT, DELETE ": "prefix.update",
+			},
+		},
+		func(routeName string) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprintf(w, "route: %s\n", routeName)
+			})
+		},
+		nil,
+	)
+
+	a := [][3]string{
+		{http.MethodGet, "/x", "route: x\n"},
+		{http.MethodGet, "/y", "route: y\n"},
+		{http.MethodPost, "/y", "route: y\n"},
+		{http.MethodGet, "/with%20space", "route: space\n"},
+		{http.MethodGet, "/prefix", "route: prefix.index\n"},
+		{http.MethodPut, "/prefix", "route: prefix.update\n"},
+		{http.MethodDelete, "/prefix", "route: prefix.update\n"},
+	}
+	for _, v := range a {
+		resp := testRequest(r, v[0], v[1], nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+		assertBody(t, resp.Body, v[2])
+	}
+}
+
+func TestRouter_ParseMap_topLevelUse(t *testing.T) {
+	r := New()
+
+	r.ParseMap(
+		map[string]interface{}{
+			"$use":    []interface{}{"a", "b"},
+			"GET":     "index",
+			" GET /x": "x",
+			"/prefix": map[string]interface{}{
+				"GET": "prefix.index",
+			},
+		},
+		func(routeName string) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprintf(w, "route: %s\n", routeName)
+			})
+		},
+		func(name string) MiddlewareFunc {
+			return func(next http.Handler) http.Handler {
+				return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Header().Add("X-Middleware", name)
+					next.ServeHTTP(w, r)
+				})
+			}
+		},
+	)
+
+	for _, path := range []string{"/", "/x", "/prefix"} {
+		resp := testRequest(r, http.MethodGet, path, nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+		if s := strings.Join(resp.Header.Values("X-Middleware"), ","); s != "a,b" {
+			t.Errorf("%s: %s != %s", path, s, "a,b")
+		}
+	}
+}
+
+func TestRouter_ParseMap_topLevelUseExplicit(t *testing.T) {
+	r := New()
+
+	r.ParseMap(
+		map[string]interface{}{
+			"$use":      "a",
+			"$notfound": "errors.notFound",
+			"GET /a":    "a",
+			"$group": map[string]interface{}{
+				"GET /b": "b",
+			},
+			"$prefix": map[string]interface{}{
+				"$path":  "/p",
+				"GET /c": "c",
+			},
+		},
+		func(routeName string) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprintf(w, "route: %s\n", routeName)
+			})
+		},
+		func(name string) MiddlewareFunc {
+			return func(next http.Handler) http.Handler {
+				return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Header().Add("X-Middleware", name)
+					next.ServeHTTP(w, r)
+				})
+			}
+		},
+	)
+
+	a := map[string]string{
+		"/a":       "route: a\n",
+		"/b":       "route: b\n",
+		"/p/c":     "route: c\n",
+		"/missing": "route: errors.notFound\n",
+	}
+	for path, body := range a {
+		resp := testRequest(r, http.MethodGet, path, nil, nil)
+		assertHeader(t, resp.Header, "X-Middleware", "a")
+		assertBody(t, resp.Body, body)
+	}
+}
+
+func TestRouter_ParseMapWith(t *testing.T) {
+	m := map[string]interface{}{
+		"$use":      "auth",
+		"$notfound": "notfound",
+		"GET":       "index",
+		"/users": map[string]interface{}{
+			"$use":      []interface{}{"auth", "log"},
+			"GET /{id}": "users.get",
+			"POST":      "users.create",
+		},
+	}
+
+	handler := func(name string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "route: %s", name)
+		})
+	}
+	handlers := map[string]http.Handler{
+		"index":     handler("index"),
+		"users.get": handler("users.get"),
+		"notfound":  http.NotFoundHandler(),
+	}
+	middlewares := map[string]MiddlewareFunc{
+		"auth": func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Add("X-Middleware", "auth")
+				next.ServeHTTP(w, r)
+			})
+		},
+	}
+
+	r := New()
+
+	err := r.ParseMapWith(m, handlers, middlewares)
+	assertError(t, err, ErrMissingHandler)
+	assertError(t, err, ErrMissingMiddleware)
+	if err == nil || err.Error() != `"log": missing middleware`+"\n"+`"users.create": missing handler` {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if routes := r.Routes(); len(routes) != 0 {
+		t.Errorf("unexpected routes: %v", routes)
+	}
+
+	handlers["users.create"] = handler("users.create")
+	middlewares["log"] = middlewares["auth"]
+
+	assertError(t, r.ParseMapWith(m, handlers, middlewares), nil)
+	{
+		resp := testRequest(r, http.MethodGet, "/users/1", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+		assertBody(t, resp.Body, "route: users.get")
+		if s := strings.Join(resp.Header.Values("X-Middleware"), ","); s != "auth,auth,auth" {
+			t.Errorf("unexpected middleware: %s", s)
+		}
+	}
+}
+
 func TestRouter_Get(t *testing.T) {
 	r := New()
 
@@ -277,6 +689,34 @@ func TestRouter_Post(t *testing.T) {
 	}
 }
 
+func TestRouter_Except(t *testing.T) {
+	r := New()
+
+	r.Except("/{path...}", http.MethodTrace, http.MethodDelete).
+		Name("any").
+		HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintln(w, r.Method)
+		})
+
+	for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodOptions} {
+		resp := testRequest(r, method, "/test", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+		assertBody(t, resp.Body, method+"\n")
+	}
+	for _, method := range []string{http.MethodTrace, http.MethodDelete} {
+		resp := testRequest(r, method, "/test", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusMethodNotAllowed)
+	}
+
+	u, err := r.Url("any", "a/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u != "/a/b" {
+		t.Errorf("%s != %s", u, "/a/b")
+	}
+}
+
 func TestRouter_Group(t *testing.T) {
 	r := New()
 
@@ -315,6 +755,32 @@ func TestRouter_Group(t *testing.T) {
 	}
 }
 
+func TestRouter_When(t *testing.T) {
+	r := New()
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "OK")
+	})
+
+	r.Prefix("/beta", func(r *Router) {
+		r.When(true, func(r *Router) {
+			r.Get("/enabled").Handle(h)
+		})
+		r.When(false, func(r *Router) {
+			r.Get("/disabled").Handle(h)
+		})
+	})
+
+	{
+		resp := testRequest(r, http.MethodGet, "/beta/enabled", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+	}
+	{
+		resp := testRequest(r, http.MethodGet, "/beta/disabled", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusNotFound)
+	}
+}
+
 func TestRouter_Prefix(t *testing.T) {
 	r := New()
 
@@ -390,30 +856,4223 @@ func TestRouter_Prefix(t *testing.T) {
 	}
 }
 
-func TestRouter_Url(t *testing.T) {
+func TestRoute_WhereFunc_order(t *testing.T) {
 	r := New()
 
-	r.Prefix("/users/{userId}", func(r *Router) {
-		r.WhereFunc("userId", func(v string) bool {
-			_, err := strconv.Atoi(v)
-			return err == nil
-		})
+	var calls []string
+	condition := func(name string, result bool) func(string) bool {
+		return func(string) bool {
+			calls = append(calls, name)
+			return result
+		}
+	}
 
-		r.Get("/articles/{articleId}").
-			Where("articleId", regexp.MustCompile(`^\d+$`)).
-			Name("users.articles.get")
-	})
+	r.Get("/{a}/{b}/{c}").
+		WhereFunc("c", condition("c", true)).
+		WhereFunc("a", condition("a", true)).
+		WhereFunc("b", condition("b", false)).
+		HandleFunc(func(w http.ResponseWriter, r *http.Request) {})
 
-	u, err := r.Url("users.articles.get", 111, 222)
-	if err != nil {
-		t.Fatal(err)
-	}
-	if u != "/users/111/articles/222" {
-		t.Errorf("%s != %s", u, "/users/111/articles/222")
+	for i := 0; i < 10; i++ {
+		calls = nil
+
+		resp := testRequest(r, http.MethodGet, "/1/2/3", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusNotFound)
+
+		if s := strings.Join(calls, ","); s != "a,b" {
+			t.Fatalf("order of conditions: %s != %s", s, "a,b")
+		}
 	}
+}
 
-	_, err = r.Url("users.articles.get", "aaa", "bbb")
-	assertError(t, err, ErrInvalidParameter)
+func TestRoute_WhereHeader(t *testing.T) {
+	r := New()
+
+	r.Get("/articles").
+		WhereHeader("X-API-Version", `^2$`).
+		HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintln(w, "v2")
+		})
+
+	r.Get("/articles").
+		WhereHeader("X-API-Version", `^1?$`).
+		HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintln(w, "v1")
+		})
+
+	{
+		resp := testRequest(r, http.MethodGet, "/articles", map[string]string{"X-API-Version": "2"}, nil)
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+		assertBody(t, resp.Body, "v2\n")
+	}
+	{
+		resp := testRequest(r, http.MethodGet, "/articles", map[string]string{"X-API-Version": "1"}, nil)
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+		assertBody(t, resp.Body, "v1\n")
+	}
+	{
+		resp := testRequest(r, http.MethodGet, "/articles", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+		assertBody(t, resp.Body, "v1\n")
+	}
+	{
+		resp := testRequest(r, http.MethodGet, "/articles", map[string]string{"X-API-Version": "3"}, nil)
+		assertStatus(t, resp.StatusCode, http.StatusNotFound)
+	}
+}
+
+func TestRoute_Transform(t *testing.T) {
+	r := New()
+
+	r.Get("/users/{name}").
+		Where("name", regexp.MustCompile(`^[A-Za-z ]+$`)).
+		Transform("name", strings.TrimSpace).
+		Transform("name", strings.ToLower).
+		HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "user: %q\n", ParamsFromRequest(r).ByName("name"))
+		})
+
+	{
+		resp := testRequest(r, http.MethodGet, "/users/%20John%20", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+		assertBody(t, resp.Body, "user: \"john\"\n")
+	}
+	{
+		// The conditions are evaluated before the transformation.
+		resp := testRequest(r, http.MethodGet, "/users/john1", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusNotFound)
+	}
+}
+
+func TestRouter_UseGlobal(t *testing.T) {
+	r := New()
+
+	r.HandlePanic(func(w http.ResponseWriter, r *http.Request, e interface{}) {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "panic: %v\n", e)
+	})
+
+	r.Group(func(r *Router) {
+		r.UseGlobal(func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("X-Global", "OK")
+				next.ServeHTTP(w, r)
+			})
+		})
+	})
+
+	r.UseGlobal(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/maintenance":
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			case "/panic":
+				panic("global")
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+
+	r.Get("/test").
+		HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintln(w, "OK")
+		})
+
+	{
+		resp := testRequest(r, http.MethodGet, "/test", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+		assertHeader(t, resp.Header, "X-Global", "OK")
+		assertBody(t, resp.Body, "OK\n")
+	}
+	{
+		resp := testRequest(r, http.MethodGet, "/missing", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusNotFound)
+		assertHeader(t, resp.Header, "X-Global", "OK")
+	}
+	{
+		resp := testRequest(r, http.MethodGet, "/maintenance", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusServiceUnavailable)
+	}
+	{
+		resp := testRequest(r, http.MethodGet, "/panic", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusInternalServerError)
+		assertBody(t, resp.Body, "panic: global\n")
+	}
+}
+
+func TestRouter_RelaxTrailingSlash(t *testing.T) {
+	r := New()
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, ParamsFromRequest(r).Values())
+	})
+
+	r.Prefix("/api", func(r *Router) {
+		r.RelaxTrailingSlash(true)
+
+		r.Get("/articles").Handle(h)
+		r.Get("/articles/{id}/").Handle(h)
+	})
+
+	r.Get("/pages").Handle(h)
+
+	{
+		resp := testRequest(r, http.MethodGet, "/api/articles/", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+		assertBody(t, resp.Body, "[]\n")
+	}
+	{
+		resp := testRequest(r, http.MethodGet, "/api/articles/111", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+		assertBody(t, resp.Body, "[111]\n")
+	}
+	{
+		resp := testRequest(r, http.MethodGet, "/api/articles/111/", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+		assertBody(t, resp.Body, "[111]\n")
+	}
+	{
+		resp := testRequest(r, http.MethodGet, "/pages/", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusMovedPermanently)
+		assertHeader(t, resp.Header, "Location", "/pages")
+	}
+}
+
+func TestRouter_RelaxTrailingSlash_explicit(t *testing.T) {
+	r := New()
+
+	handler := func(s string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, s)
+		}
+	}
+
+	r.RelaxTrailingSlash(true)
+	r.Get("/x").HandleFunc(handler("x"))
+	r.Get("/y").HandleFunc(handler("y"))
+	r.Get("/x/").HandleFunc(handler("x/"))
+
+	a := map[string]string{
+		"/x":  "x",
+		"/x/": "x/",
+		"/y":  "y",
+		"/y/": "y",
+	}
+	for path, body := range a {
+		resp := testRequest(r, http.MethodGet, path, nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+		assertBody(t, resp.Body, body)
+	}
+
+	clone := r.DeepClone()
+	clone.RemoveRoute(http.MethodGet, "/y")
+	for _, path := range []string{"/y", "/y/"} {
+		resp := testRequest(clone, http.MethodGet, path, nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusNotFound)
+	}
+}
+
+func TestRoute_Conditions(t *testing.T) {
+	r := New()
+
+	var route *Route
+	r.Prefix("/users/{userId}", func(r *Router) {
+		r.Where("userId", regexp.MustCompile(`^\d+$`))
+
+		route = r.Get("/articles/{articleId}/{slug}").
+			Where("articleId", regexp.MustCompile(`^[0-9a-f]+$`)).
+			WhereFunc("slug", func(v string) bool { return v != "" })
+	})
+
+	c := route.Conditions()
+	expected := map[string]string{
+		"userId":    `^\d+$`,
+		"articleId": `^[0-9a-f]+$`,
+	}
+	if fmt.Sprint(c) != fmt.Sprint(expected) {
+		t.Errorf("%v != %v", c, expected)
+	}
+}
+
+func TestRouter_Get_dottedParams(t *testing.T) {
+	r := New()
+
+	r.Get("/users/{user.id}/files/{file.path...}").
+		Where("user.id", regexp.MustCompile(`^\d+$`)).
+		Name("users.files").
+		HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+			params := ParamsFromRequest(r)
+			fmt.Fprintf(w, "%s %s\n", params.ByName("user.id"), params.ByName("file.path"))
+		})
+
+	{
+		resp := testRequest(r, http.MethodGet, "/users/111/files/a/b", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+		assertBody(t, resp.Body, "111 a/b\n")
+	}
+
+	u, err := r.Url("users.files", 111, "a/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u != "/users/111/files/a/b" {
+		t.Errorf("%s != %s", u, "/users/111/files/a/b")
+	}
+}
+
+func TestRouter_Prefix_emptyPath(t *testing.T) {
+	r := New()
+
+	h := func(name string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintln(w, name)
+		}
+	}
+
+	a := map[string]*Route{}
+	r.Prefix("/x", func(r *Router) {
+		a["/x"] = r.Get("").HandleFunc(h("empty"))
+		a["/x/"] = r.Get("/").HandleFunc(h("slash"))
+		a["/x/y"] = r.Get("/y").HandleFunc(h("y"))
+	})
+	r.Prefix("/z/", func(r *Router) {
+		a["/z/w"] = r.Get("/w").HandleFunc(h("w"))
+	})
+	r.Prefix("", func(r *Router) {
+		a["/"] = r.Get("").HandleFunc(h("root"))
+	})
+
+	for expected, route := range a {
+		if route.Pattern() != expected {
+			t.Errorf("pattern: %s != %s", route.Pattern(), expected)
+		}
+	}
+
+	for path, body := range map[string]string{
+		"/":    "root\n",
+		"/x":   "empty\n",
+		"/x/":  "slash\n",
+		"/x/y": "y\n",
+		"/z/w": "w\n",
+	} {
+		resp := testRequest(r, http.MethodGet, path, nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+		assertBody(t, resp.Body, body)
+	}
+}
+
+func TestRouter_Regexp(t *testing.T) {
+	r := New()
+
+	var sub *regexp.Regexp
+	r.Prefix("/api", func(r *Router) {
+		sub = r.Regexp(`^\d+$`)
+	})
+
+	if r.Regexp(`^\d+$`) != sub {
+		t.Errorf("regular expression compiled twice")
+	}
+	if !sub.MatchString("111") {
+		t.Errorf("invalid regular expression")
+	}
+}
+
+func TestRoute_Consumes(t *testing.T) {
+	r := New()
+
+	r.Post("/articles").
+		Consumes("application/json").
+		HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintln(w, "json")
+		})
+
+	r.Post("/articles").
+		Consumes("application/x-www-form-urlencoded").
+		HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintln(w, "form")
+		})
+
+	r.Post("/upload").
+		Consumes("image/*").
+		HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintln(w, "image")
+		})
+
+	{
+		resp := testRequest(r, http.MethodPost, "/articles", map[string]string{"Content-Type": "application/json; charset=utf-8"}, nil)
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+		assertBody(t, resp.Body, "json\n")
+	}
+	{
+		resp := testRequest(r, http.MethodPost, "/articles", nil, map[string]string{"title": "Test"})
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+		assertBody(t, resp.Body, "form\n")
+	}
+	{
+		resp := testRequest(r, http.MethodPost, "/articles", map[string]string{"Content-Type": "text/plain"}, nil)
+		assertStatus(t, resp.StatusCode, http.StatusUnsupportedMediaType)
+	}
+	{
+		resp := testRequest(r, http.MethodPost, "/articles", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusUnsupportedMediaType)
+	}
+	{
+		resp := testRequest(r, http.MethodPost, "/upload", map[string]string{"Content-Type": "image/png"}, nil)
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+		assertBody(t, resp.Body, "image\n")
+	}
+}
+
+func TestRouter_Get_formatSuffix(t *testing.T) {
+	r := New()
+
+	r.Get("/articles/{id}.{format}").
+		Where("format", regexp.MustCompile(`^(json|xml)$`)).
+		Name("articles.get.format").
+		HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintln(w, ParamsFromRequest(r).Map())
+		})
+
+	r.Get("/articles/{id}").
+		HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintln(w, ParamsFromRequest(r).Map())
+		})
+
+	r.Get("/files/v{version}/{name}.tar.gz").
+		HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintln(w, ParamsFromRequest(r).Map())
+		})
+
+	for path, body := range map[string]string{
+		"/articles/5.json":        "map[format:json id:5]\n",
+		"/articles/5.xml":         "map[format:xml id:5]\n",
+		"/articles/a.b.json":      "map[format:json id:a.b]\n",
+		"/articles/5":             "map[id:5]\n",
+		"/articles/5.txt":         "map[id:5.txt]\n",
+		"/files/v2/router.tar.gz": "map[name:router version:2]\n",
+	} {
+		resp := testRequest(r, http.MethodGet, path, nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+		assertBody(t, resp.Body, body)
+	}
+	{
+		resp := testRequest(r, http.MethodGet, "/files/v2/router.zip", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusNotFound)
+	}
+
+	u, err := r.Url("articles.get.format", 5, "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u != "/articles/5.json" {
+		t.Errorf("%s != %s", u, "/articles/5.json")
+	}
+}
+
+func TestRouter_UsePanicHandler(t *testing.T) {
+	r := New()
+
+	buf := new(bytes.Buffer)
+	r.UsePanicHandler(
+		PanicLogger(log.New(buf, "", 0)),
+		func(w http.ResponseWriter, r *http.Request, e interface{}) {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, "error: %v\n", e)
+		},
+	)
+
+	r.Get("/panic").
+		HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic("test")
+		})
+
+	resp := testRequest(r, http.MethodGet, "/panic", nil, nil)
+	assertStatus(t, resp.StatusCode, http.StatusInternalServerError)
+	assertBody(t, resp.Body, "error: test\n")
+
+	if !strings.HasPrefix(buf.String(), "panic: GET /panic: test\n") {
+		t.Errorf("invalid log: %s", buf)
+	}
+}
+
+func TestRoute_Url_escape(t *testing.T) {
+	r := New()
+
+	route := r.Get("/search/{query}").Where("query", regexp.MustCompile(`^[^%]*[/?#]`))
+	files := r.Get("/files/{path...}")
+
+	a := [][2]string{
+		{"a/b", "/search/a%2Fb"},
+		{"what?", "/search/what%3F"},
+		{"#1 c/d", "/search/%231%20c%2Fd"},
+	}
+	for _, v := range a {
+		u, err := route.Url(v[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if u != v[1] {
+			t.Errorf("%s != %s", u, v[1])
+		}
+
+		params, ok := route.ParseUrl(u)
+		if !ok || params.ByName("query") != v[0] {
+			t.Errorf("unexpected params: %v", params)
+		}
+	}
+
+	_, err := route.Url("100%")
+	assertError(t, err, ErrInvalidParameter)
+
+	u, err := files.Url("dir/a b/100%.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u != "/files/dir/a%20b/100%25.txt" {
+		t.Errorf("%s != %s", u, "/files/dir/a%20b/100%25.txt")
+	}
+
+	resp := httptest.NewRecorder()
+	files.HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, ParamsFromRequest(r).ByName("path"))
+	})
+	r.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, u, nil))
+	assertBody(t, resp.Body, "dir/a b/100%.txt")
+}
+
+func TestRoute_ParseUrl(t *testing.T) {
+	r := New()
+
+	route := r.Get("/users/{userId}/articles/{slug}.{format}").
+		Where("userId", regexp.MustCompile(`^\d+$`))
+	files := r.Get("/files/{path...}")
+
+	u, err := route.Url(111, "test.v2", "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	params, ok := route.ParseUrl(u + "?a=1")
+	if !ok {
+		t.Fatalf("%s does not match", u)
+	}
+	expected := map[string]string{"userId": "111", "slug": "test.v2", "format": "json"}
+	if fmt.Sprint(params.Map()) != fmt.Sprint(expected) {
+		t.Errorf("%v != %v", params.Map(), expected)
+	}
+
+	for _, path := range []string{"/users/abc/articles/test.json", "/users/111/articles/test", "/users/111"} {
+		if _, ok := route.ParseUrl(path); ok {
+			t.Errorf("%s matches", path)
+		}
+	}
+
+	params, ok = files.ParseUrl("/files/a/b/c")
+	if !ok || params.ByName("path") != "a/b/c" {
+		t.Errorf("unexpected params: %v", params)
+	}
+}
+
+func TestRoute_Priority(t *testing.T) {
+	r := New()
+
+	r.Get("/{name}").
+		HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, "by name")
+		})
+	byID := r.Get("/{id}").
+		Where("id", regexp.MustCompile(`^\d+$`)).
+		HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, "by id")
+		})
+
+	{
+		resp := testRequest(r, http.MethodGet, "/111", nil, nil)
+		assertBody(t, resp.Body, "by name")
+	}
+
+	byID.Priority(1)
+
+	{
+		resp := testRequest(r, http.MethodGet, "/111", nil, nil)
+		assertBody(t, resp.Body, "by id")
+	}
+	{
+		resp := testRequest(r, http.MethodGet, "/abc", nil, nil)
+		assertBody(t, resp.Body, "by name")
+	}
+
+	r.Get("/{uuid}").
+		Where("uuid", regexp.MustCompile(`^[0-9a-f-]{36}$`)).
+		Priority(2).
+		HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, "by uuid")
+		})
+
+	{
+		resp := testRequest(r, http.MethodGet, "/123e4567-e89b-12d3-a456-426614174000", nil, nil)
+		assertBody(t, resp.Body, "by uuid")
+	}
+}
+
+func TestRoute_AndWhere_OrWhere(t *testing.T) {
+	r := New()
+
+	h := func(w http.ResponseWriter, r *http.Request) {}
+
+	and := r.Get("/and/{id}").
+		Where("id", regexp.MustCompile(`^\d+$`)).
+		AndWhereFunc("id", func(s string) bool { return len(s) <= 3 }).
+		HandleFunc(h)
+	or := r.Get("/or/{id}").
+		Where("id", regexp.MustCompile(`^\d+$`)).
+		OrWhere("id", regexp.MustCompile(`^[a-z]+$`)).
+		HandleFunc(h)
+	r.Prefix("/prefix/{id}", func(r *Router) {
+		r.Where("id", regexp.MustCompile(`^\d+$`))
+		r.Get("").OrWhere("id", regexp.MustCompile(`^me$`)).HandleFunc(h)
+		r.Get("/new").AndWhere("id", regexp.MustCompile(`^[1-5]+$`)).HandleFunc(h)
+	})
+
+	a := []struct {
+		path   string
+		status int
+	}{
+		{"/and/123", http.StatusOK},
+		{"/and/1234", http.StatusNotFound},
+		{"/and/abc", http.StatusNotFound},
+		{"/or/123", http.StatusOK},
+		{"/or/abc", http.StatusOK},
+		{"/or/a1", http.StatusNotFound},
+		{"/prefix/1", http.StatusOK},
+		{"/prefix/me", http.StatusOK},
+		{"/prefix/you", http.StatusNotFound},
+		{"/prefix/15/new", http.StatusOK},
+		{"/prefix/19/new", http.StatusNotFound},
+	}
+	for _, v := range a {
+		resp := testRequest(r, http.MethodGet, v.path, nil, nil)
+		if resp.StatusCode != v.status {
+			t.Errorf("%s: %d != %d", v.path, resp.StatusCode, v.status)
+		}
+	}
+
+	if c := and.Conditions(); len(c) != 0 {
+		t.Errorf("unexpected conditions: %v", c)
+	}
+	if c := or.Conditions()["id"]; c != `(?:^\d+$)|(?:^[a-z]+$)` {
+		t.Errorf("unexpected condition: %s", c)
+	}
+}
+
+func TestRoute_WhereElse(t *testing.T) {
+	r := New()
+
+	unprocessable := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid id", http.StatusUnprocessableEntity)
+	})
+
+	r.Get("/articles/{id}").
+		WhereElse("id", regexp.MustCompile(`^\d+$`), unprocessable).
+		HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, "by id")
+		})
+	r.Get("/articles/{id}").
+		Where("id", regexp.MustCompile(`^[a-z]+$`)).
+		HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, "by slug")
+		})
+
+	{
+		resp := testRequest(r, http.MethodGet, "/articles/111", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+		assertBody(t, resp.Body, "by id")
+	}
+	{
+		resp := testRequest(r, http.MethodGet, "/articles/abc", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+		assertBody(t, resp.Body, "by slug")
+	}
+	{
+		resp := testRequest(r, http.MethodGet, "/articles/ABC", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusUnprocessableEntity)
+		assertBody(t, resp.Body, "invalid id\n")
+	}
+}
+
+func TestRouter_Where_existingRoutes(t *testing.T) {
+	r := New()
+
+	h := func(name string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, name)
+		}
+	}
+
+	r.Prefix("/users/{id}", func(r *Router) {
+		r.Get("/before").HandleFunc(h("before"))
+
+		r.Where("id", regexp.MustCompile(`^\d+$`))
+
+		r.Get("/after").HandleFunc(h("after"))
+		r.Get("/own").Where("id", regexp.MustCompile(`^[a-z]+$`)).HandleFunc(h("own"))
+		r.Get("/shared").HandleFunc(h("shared"))
+
+		r.Prefix("/group", func(r *Router) {
+			r.Where("id", regexp.MustCompile(`^1$`))
+			r.Get("").HandleFunc(h("group"))
+		})
+		r.Get("/last").HandleFunc(h("last"))
+	})
+
+	a := []struct {
+		path   string
+		status int
+	}{
+		{"/users/abc/before", http.StatusOK},
+		{"/users/abc/after", http.StatusNotFound},
+		{"/users/1/after", http.StatusOK},
+		{"/users/abc/own", http.StatusOK},
+		{"/users/1/own", http.StatusNotFound},
+		{"/users/1/shared", http.StatusOK},
+		{"/users/2/group", http.StatusNotFound},
+		{"/users/1/group", http.StatusOK},
+		{"/users/2/last", http.StatusOK},
+		{"/users/abc/last", http.StatusNotFound},
+	}
+	for _, v := range a {
+		resp := testRequest(r, http.MethodGet, v.path, nil, nil)
+		if resp.StatusCode != v.status {
+			t.Errorf("%s: %d != %d", v.path, resp.StatusCode, v.status)
+		}
+	}
+}
+
+func TestRoute_Validate(t *testing.T) {
+	r := New()
+
+	r.Post("/users/{id}").
+		Validate(func(r *http.Request) error {
+			if r.Header.Get("Content-Type") != "application/json" {
+				return errors.New("unsupported content type")
+			}
+			return nil
+		}).
+		Validate(func(r *http.Request) error {
+			if ParamsFromRequest(r).ByName("id") == "0" {
+				return &StatusError{Status: http.StatusUnprocessableEntity, Err: errors.New("invalid id")}
+			}
+			return nil
+		}).
+		HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, "valid")
+		})
+	r.Post("/users/{id}").HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "fallback")
+	})
+
+	json := map[string]string{"Content-Type": "application/json"}
+	{
+		resp := testRequest(r, http.MethodPost, "/users/1", json, nil)
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+		assertBody(t, resp.Body, "valid")
+	}
+	{
+		resp := testRequest(r, http.MethodPost, "/users/1", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusBadRequest)
+		assertBody(t, resp.Body, `{"error":"unsupported content type"}`+"\n")
+	}
+
+	other := r.DeepClone()
+
+	errorStatus := r.ErrorStatus
+	r.SetInvalidRequestHandler(func(w http.ResponseWriter, r *http.Request, err error) {
+		writeJSONError(w, errorStatus(err), err)
+	})
+
+	{
+		resp := testRequest(r, http.MethodPost, "/users/0", json, nil)
+		assertStatus(t, resp.StatusCode, http.StatusUnprocessableEntity)
+		assertBody(t, resp.Body, `{"error":"invalid id"}`+"\n")
+	}
+	{
+		resp := testRequest(other, http.MethodPost, "/users/0", json, nil)
+		assertStatus(t, resp.StatusCode, http.StatusBadRequest)
+		assertBody(t, resp.Body, `{"error":"invalid id"}`+"\n")
+	}
+}
+
+func TestRoute_WhereQuery(t *testing.T) {
+	r := New()
+
+	handler := func(s string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, s)
+		}
+	}
+
+	r.Get("/search").WhereQuery("type", `^image$`).HandleFunc(handler("images"))
+	r.Get("/search").WhereQuery("type", `^video$`).HandleFunc(handler("videos"))
+	r.Get("/search").HandleFunc(handler("all"))
+	r.Get("/strict").WhereQuery("q", `.`).HandleFunc(handler("strict"))
+
+	a := []struct {
+		target   string
+		status   int
+		expected string
+	}{
+		{"/search?type=image", http.StatusOK, "images"},
+		{"/search?type=video&page=2", http.StatusOK, "videos"},
+		{"/search?type=text", http.StatusOK, "all"},
+		{"/search?type=text&type=video", http.StatusOK, "videos"},
+		{"/search", http.StatusOK, "all"},
+		{"/strict?q=test", http.StatusOK, "strict"},
+		{"/strict?q=", http.StatusNotFound, "404 page not found\n"},
+		{"/strict", http.StatusNotFound, "404 page not found\n"},
+	}
+	for _, v := range a {
+		resp := testRequest(r, http.MethodGet, v.target, nil, nil)
+		assertStatus(t, resp.StatusCode, v.status)
+		assertBody(t, resp.Body, v.expected)
+	}
+}
+
+func TestRoute_NoTraversal(t *testing.T) {
+	r := New()
+
+	r.Get("/files/{path...}").NoTraversal().HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, ParamsFromRequest(r).ByName("path"))
+	})
+
+	a := []struct {
+		path   string
+		status int
+	}{
+		{"/files/a/b.txt", http.StatusOK},
+		{"/files/a..b/c.txt", http.StatusOK},
+		{"/files/a/../../etc/passwd", http.StatusNotFound},
+		{"/files/..", http.StatusNotFound},
+		{"/files/%2e%2e/etc/passwd", http.StatusNotFound},
+		{"/files/..%2fetc", http.StatusNotFound},
+		{"/files/%252e%252e/etc", http.StatusNotFound},
+		{"/files/a%5c..%5cb", http.StatusNotFound},
+		{"/files/a%00.txt", http.StatusNotFound},
+	}
+	for _, v := range a {
+		resp := testRequest(r, http.MethodGet, v.path, nil, nil)
+		if resp.StatusCode != v.status {
+			t.Errorf("%s: %d != %d", v.path, resp.StatusCode, v.status)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("no panic for a route without a catch-all parameter")
+		}
+	}()
+	r.Get("/articles/{id}").NoTraversal()
+}
+
+func TestRoute_WebSocket(t *testing.T) {
+	r := New()
+
+	r.Get("/chat").WebSocket().HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "websocket")
+	})
+	r.Get("/chat").HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "page")
+	})
+
+	a := []struct {
+		headers  map[string]string
+		expected string
+	}{
+		{nil, "page"},
+		{map[string]string{"Connection": "Upgrade", "Upgrade": "websocket"}, "websocket"},
+		{map[string]string{"Connection": "keep-alive, Upgrade", "Upgrade": "WebSocket"}, "websocket"},
+		{map[string]string{"Connection": "keep-alive", "Upgrade": "websocket"}, "page"},
+		{map[string]string{"Connection": "Upgrade", "Upgrade": "h2c"}, "page"},
+	}
+	for _, v := range a {
+		resp := testRequest(r, http.MethodGet, "/chat", v.headers, nil)
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+		assertBody(t, resp.Body, v.expected)
+	}
+}
+
+func TestRoute_HandleLazy(t *testing.T) {
+	r := New()
+
+	var calls int32
+	route := r.Get("/lazy").HandleLazy(func() http.Handler {
+		atomic.AddInt32(&calls, 1)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, "lazy")
+		})
+	})
+
+	if !route.HasHandler() {
+		t.Error("lazy route has no handler")
+	}
+	if n := atomic.LoadInt32(&calls); n != 0 {
+		t.Errorf("%d calls before the first request", n)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp := testRequest(r, http.MethodGet, "/lazy", nil, nil)
+			assertBody(t, resp.Body, "lazy")
+		}()
+	}
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("%d calls != 1", n)
+	}
+}
+
+func TestRoute_HandleLazy_failure(t *testing.T) {
+	r := New()
+
+	r.HandlePanic(func(w http.ResponseWriter, r *http.Request, e interface{}) {
+		http.Error(w, fmt.Sprint(e), http.StatusServiceUnavailable)
+	})
+
+	var calls int
+	r.Get("/lazy").HandleLazy(func() http.Handler {
+		calls++
+		switch calls {
+		case 1:
+			panic("not ready")
+		case 2:
+			return nil
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, "lazy")
+		})
+	})
+
+	tests := []struct {
+		status int
+		body   string
+	}{
+		{http.StatusServiceUnavailable, "not ready\n"},
+		{http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError) + "\n"},
+		{http.StatusOK, "lazy"},
+		{http.StatusOK, "lazy"},
+	}
+	for _, test := range tests {
+		resp := testRequest(r, http.MethodGet, "/lazy", nil, nil)
+		assertStatus(t, resp.StatusCode, test.status)
+		assertBody(t, resp.Body, test.body)
+	}
+
+	if calls != 3 {
+		t.Errorf("%d calls != 3", calls)
+	}
+}
+
+func TestRoute_HandleWith(t *testing.T) {
+	r := New()
+
+	r.Get("/users/{userId}/articles/{slug}.{format}").
+		HandleWith(func(w http.ResponseWriter, r *http.Request, userID int, slug string) {
+			fmt.Fprintf(w, "user: %d, slug: %s\n", userID, slug)
+		})
+
+	r.Get("/flags/{on}").
+		HandleWith(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, "no args")
+		})
+
+	{
+		resp := testRequest(r, http.MethodGet, "/users/111/articles/test.json", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+		assertBody(t, resp.Body, "user: 111, slug: test\n")
+	}
+	{
+		resp := testRequest(r, http.MethodGet, "/users/abc/articles/test.json", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusBadRequest)
+	}
+	{
+		resp := testRequest(r, http.MethodGet, "/flags/1", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+		assertBody(t, resp.Body, "no args")
+	}
+
+	invalid := []interface{}{
+		func(w http.ResponseWriter) {},
+		func(w http.ResponseWriter, r *http.Request) error { return nil },
+		func(w http.ResponseWriter, r *http.Request, a, b int) {},
+		func(w http.ResponseWriter, r *http.Request, a []int) {},
+		"not a function",
+	}
+	for _, fn := range invalid {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("no panic for %T", fn)
+				}
+			}()
+			r.Get("/invalid/{id}").HandleWith(fn)
+		}()
+	}
+}
+
+func TestRouter_Url(t *testing.T) {
+	r := New()
+
+	r.Prefix("/users/{userId}", func(r *Router) {
+		r.WhereFunc("userId", func(v string) bool {
+			_, err := strconv.Atoi(v)
+			return err == nil
+		})
+
+		r.Get("/articles/{articleId}").
+			Where("articleId", regexp.MustCompile(`^\d+$`)).
+			Name("users.articles.get")
+	})
+
+	u, err := r.Url("users.articles.get", 111, 222)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u != "/users/111/articles/222" {
+		t.Errorf("%s != %s", u, "/users/111/articles/222")
+	}
+
+	_, err = r.Url("users.articles.get", "aaa", "bbb")
+	assertError(t, err, ErrInvalidParameter)
+}
+
+func TestRoute_HttpRouterPattern(t *testing.T) {
+	r := New()
+
+	a := r.Get("/users/{id}/files/{path...}")
+	b := r.Get("/users/{name}/files/{file...}")
+
+	if p := a.HttpRouterPattern(); p != "/users/:0/files/*1" {
+		t.Errorf("%s != %s", p, "/users/:0/files/*1")
+	}
+	if a.HttpRouterPattern() != b.HttpRouterPattern() {
+		t.Errorf("%s != %s", a.HttpRouterPattern(), b.HttpRouterPattern())
+	}
+}
+
+func TestRoute_Url_catchAll(t *testing.T) {
+	r := New()
+	r.StrictUrlParams(true)
+
+	route := r.Get("/files/{bucket}/{path...}").
+		Where("path", regexp.MustCompile(`^[^.]+(/[^.]+)*\.txt$`))
+
+	a := []struct {
+		params []interface{}
+		url    string
+	}{
+		{[]interface{}{"b", "dir/a b/c.txt"}, "/files/b/dir/a%20b/c.txt"},
+		{[]interface{}{"b", []string{"dir", "a b", "c.txt"}}, "/files/b/dir/a%20b/c.txt"},
+		{[]interface{}{"b", "dir", "a b", "c.txt"}, "/files/b/dir/a%20b/c.txt"},
+		{[]interface{}{"b", []string{"100%", "x?"}, "c.txt"}, "/files/b/100%25/x%3F/c.txt"},
+	}
+	for _, v := range a {
+		u, err := route.Url(v.params...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if u != v.url {
+			t.Errorf("%s != %s", u, v.url)
+		}
+	}
+
+	_, err := route.Url("b", []string{"dir", "c"})
+	assertError(t, err, ErrInvalidParameter)
+}
+
+func TestRouter_RoutesByTag(t *testing.T) {
+	r := New()
+
+	r.Get("/").Tag("public")
+	r.Prefix("/admin", func(r *Router) {
+		r.Tag("admin")
+		r.Get("/users").Tag("users")
+		r.Group(func(r *Router) {
+			r.Tag("danger")
+			r.Delete("/users/{id}").Tag("users", "admin")
+		})
+		r.Get("/stats")
+	})
+	r.Get("/users").Tag("users", "public")
+
+	tags := func(routes []*Route) []string {
+		a := make([]string, len(routes))
+		for i, route := range routes {
+			a[i] = route.String() + " " + strings.Join(route.Tags(), ",")
+		}
+		return a
+	}
+
+	for tag, expected := range map[string][]string{
+		"admin": {
+			"GET /admin/stats admin",
+			"GET /admin/users admin,users",
+			"DELETE /admin/users/{id} admin,danger,users",
+		},
+		"users": {
+			"GET /admin/users admin,users",
+			"DELETE /admin/users/{id} admin,danger,users",
+			"GET /users users,public",
+		},
+		"danger": {
+			"DELETE /admin/users/{id} admin,danger,users",
+		},
+		"none": {},
+	} {
+		if a := tags(r.RoutesByTag(tag)); fmt.Sprint(a) != fmt.Sprint(expected) {
+			t.Errorf("%s: %q != %q", tag, a, expected)
+		}
+	}
+
+	if a := tags(r.DeepClone().RoutesByTag("danger")); len(a) != 1 {
+		t.Errorf("unexpected routes of the clone: %q", a)
+	}
+}
+
+func TestRouter_UseForTag(t *testing.T) {
+	r := New()
+
+	var log []string
+	sink := func(s string) { log = append(log, s) }
+
+	h := func(w http.ResponseWriter, r *http.Request) {
+		sink("handler")
+	}
+
+	r.Use(Tap("use", sink))
+
+	before := r.Get("/admin/before").Tag("admin").HandleFunc(h)
+	r.Get("/public").HandleFunc(h)
+
+	r.UseForTag("admin", Tap("admin", sink))
+
+	r.Prefix("/admin", func(r *Router) {
+		r.Tag("admin")
+		r.Get("/after").HandleFunc(h)
+	})
+	r.Get("/late").HandleFunc(h).Tag("admin")
+	r.Get("/health").Tag("admin").SkipMiddleware().HandleFunc(h)
+
+	for path, expected := range map[string]string{
+		"/admin/before": "enter use,enter admin,handler,exit admin,exit use",
+		"/admin/after":  "enter use,enter admin,handler,exit admin,exit use",
+		"/late":         "enter use,enter admin,handler,exit admin,exit use",
+		"/health":       "enter admin,handler,exit admin",
+		"/public":       "enter use,handler,exit use",
+	} {
+		log = nil
+		resp := testRequest(r, http.MethodGet, path, nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+		if s := strings.Join(log, ","); s != expected {
+			t.Errorf("%s: %s != %s", path, s, expected)
+		}
+	}
+
+	if n := before.MiddlewareCount(); n != 2 {
+		t.Errorf("middleware count: %d != %d", n, 2)
+	}
+}
+
+func TestRouter_Url_splitMethods(t *testing.T) {
+	r := New()
+
+	h := func(w http.ResponseWriter, r *http.Request) {}
+
+	r.Get("/forms/{id}").Where("id", regexp.MustCompile(`^\d+$`)).Name("form").HandleFunc(h)
+	r.Post("/forms/{id}").Name("form").HandleFunc(h)
+
+	u, err := r.Url("form", 1)
+	if err != nil || u != "/forms/1" {
+		t.Errorf("unexpected url: %s, %v", u, err)
+	}
+
+	// The first route is used, with its conditions.
+	_, err = r.Url("form", "abc")
+	assertError(t, err, ErrInvalidParameter)
+
+	if err := r.Validate(); err != nil {
+		t.Error(err)
+	}
+
+	r.RemoveRoute(http.MethodGet, "/forms/{id}")
+
+	u, err = r.Url("form", "abc")
+	if err != nil || u != "/forms/abc" {
+		t.Errorf("unexpected url: %s, %v", u, err)
+	}
+
+	r.Get("/other").Name("form").HandleFunc(h)
+
+	u, err = r.Url("form")
+	if err != nil || u != "/other" {
+		t.Errorf("unexpected url: %s, %v", u, err)
+	}
+	assertError(t, r.Validate(), ErrDuplicateName)
+}
+
+func TestRouter_Urls(t *testing.T) {
+	r := New()
+
+	handler := func(w http.ResponseWriter, r *http.Request) {}
+	r.Get("/").Name("home").HandleFunc(handler)
+	r.Get("/users/{id}").Name("users.get").Where("id", regexp.MustCompile(`^\d+$`)).HandleFunc(handler)
+	r.Get("/files/{path...}").Name("files").HandleFunc(handler)
+
+	urls, err := r.Urls([]UrlRequest{
+		{Name: "home"},
+		{Name: "users.get", Params: []interface{}{1}},
+		{Name: "files", Params: []interface{}{"a", "b c"}},
+	})
+	assertError(t, err, nil)
+	if s := fmt.Sprint(urls); s != "[/ /users/1 /files/a/b%20c]" {
+		t.Errorf("unexpected urls: %s", s)
+	}
+
+	urls, err = r.Urls([]UrlRequest{
+		{Name: "users.get", Params: []interface{}{"a"}},
+		{Name: "home"},
+		{Name: "missing"},
+	})
+	assertError(t, err, ErrInvalidParameter)
+	assertError(t, err, ErrRouteNotFound)
+	if s := fmt.Sprintf("%q", urls); s != `["" "/" ""]` {
+		t.Errorf("unexpected urls: %s", s)
+	}
+
+	var e *ValidationError
+	if !errors.As(err, &e) || len(e.Errors) != 2 || !strings.HasPrefix(e.Errors[1].Error(), "2: missing") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestRouter_UrlForMethod(t *testing.T) {
+	r := New()
+
+	h := func(w http.ResponseWriter, r *http.Request) {}
+
+	r.Get("/articles/{id}").Name("article").HandleFunc(h)
+	r.NewRoute("/legacy/articles/{id}/update", http.MethodPost, http.MethodPut).Name("article").HandleFunc(h)
+	r.Get("/users/{id}").Name("user").HandleFunc(h)
+	r.Delete("/users/{id}").Name("user").HandleFunc(h)
+
+	a := []struct {
+		name   string
+		method string
+		url    string
+	}{
+		{"article", http.MethodGet, "/articles/1"},
+		{"article", http.MethodPost, "/legacy/articles/1/update"},
+		{"article", http.MethodPut, "/legacy/articles/1/update"},
+		{"user", http.MethodGet, "/users/1"},
+		{"user", http.MethodDelete, "/users/1"},
+	}
+	for _, v := range a {
+		u, err := r.UrlForMethod(v.name, v.method, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if u != v.url {
+			t.Errorf("%s %s: %s != %s", v.method, v.name, u, v.url)
+		}
+	}
+
+	u, err := r.Url("user", 1)
+	if err != nil || u != "/users/1" {
+		t.Errorf("unexpected url: %s, %v", u, err)
+	}
+
+	_, err = r.UrlForMethod("article", http.MethodDelete, 1)
+	assertError(t, err, ErrRouteNotFound)
+
+	_, err = r.UrlForMethod("missing", http.MethodGet)
+	assertError(t, err, ErrRouteNotFound)
+}
+
+func TestRouter_StrictUrlParams(t *testing.T) {
+	r := New()
+	r.Get("/users/{id}").Name("users.get")
+
+	u, err := r.Url("users.get", 1, "extra")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u != "/users/1/extra" {
+		t.Errorf("%s != %s", u, "/users/1/extra")
+	}
+
+	r.StrictUrlParams(true)
+
+	_, err = r.Url("users.get", 1, "extra")
+	assertError(t, err, ErrTooManyParameters)
+
+	u, err = r.Url("users.get", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u != "/users/1" {
+		t.Errorf("%s != %s", u, "/users/1")
+	}
+}
+
+func TestRouter_AutoHead(t *testing.T) {
+	r := New()
+
+	r.Get("/users/{id}").Name("users.get").HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Method", r.Method)
+		fmt.Fprint(w, "user")
+	})
+	r.Get("/files/{path...}").HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Method", r.Method)
+	})
+	r.Get("/files/index").HandleFunc(func(w http.ResponseWriter, r *http.Request) {})
+	r.Post("/users").HandleFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	if methods := r.AllowedMethods("/users/1"); fmt.Sprint(methods) != "[GET]" {
+		t.Errorf("unexpected methods: %v", methods)
+	}
+
+	r.AutoHead(true)
+
+	for _, path := range []string{"/users/1", "/files/a/b"} {
+		resp := testRequest(r, http.MethodHead, path, nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+		assertHeader(t, resp.Header, "X-Method", http.MethodHead)
+	}
+	{
+		resp := testRequest(r, http.MethodHead, "/users", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusMethodNotAllowed)
+	}
+
+	if methods := r.AllowedMethods("/users/1"); fmt.Sprint(methods) != "[GET HEAD]" {
+		t.Errorf("unexpected methods: %v", methods)
+	}
+	if methods := r.AllowedMethods("/users"); fmt.Sprint(methods) != "[POST]" {
+		t.Errorf("unexpected methods: %v", methods)
+	}
+
+	b := new(bytes.Buffer)
+	r.PrintRoutes(b)
+	if !strings.Contains(b.String(), "GET,HEAD") {
+		t.Errorf("no HEAD in routes:\n%s", b)
+	}
+
+	u, err := r.Url("users.get", 1)
+	if err != nil || u != "/users/1" {
+		t.Errorf("unexpected url: %s, %v", u, err)
+	}
+}
+
+func TestConcurrency(t *testing.T) {
+	r := New()
+
+	entered := make(chan struct{})
+	release := make(chan struct{})
+
+	r.Prefix("/reject", func(r *Router) {
+		r.Use(Concurrency(1, 0))
+		r.Get("/block").HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+			entered <- struct{}{}
+			<-release
+		})
+		r.Get("/panic").HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic("test")
+		})
+	})
+	r.Prefix("/wait", func(r *Router) {
+		r.Use(Concurrency(1, time.Second))
+		r.Get("/block").HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+			entered <- struct{}{}
+			<-release
+		})
+	})
+
+	r.HandlePanic(func(w http.ResponseWriter, r *http.Request, rcv interface{}) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	{
+		done := make(chan *http.Response)
+		go func() {
+			done <- testRequest(r, http.MethodGet, "/reject/block", nil, nil)
+		}()
+		<-entered
+
+		resp := testRequest(r, http.MethodGet, "/reject/panic", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusServiceUnavailable)
+
+		release <- struct{}{}
+		assertStatus(t, (<-done).StatusCode, http.StatusOK)
+	}
+	{
+		resp := testRequest(r, http.MethodGet, "/reject/panic", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusInternalServerError)
+
+		resp = testRequest(r, http.MethodGet, "/reject/panic", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusInternalServerError)
+	}
+	{
+		done := make(chan *http.Response, 2)
+		for i := 0; i < 2; i++ {
+			go func() {
+				done <- testRequest(r, http.MethodGet, "/wait/block", nil, nil)
+			}()
+		}
+
+		for i := 0; i < 2; i++ {
+			<-entered
+			release <- struct{}{}
+		}
+		for i := 0; i < 2; i++ {
+			assertStatus(t, (<-done).StatusCode, http.StatusOK)
+		}
+	}
+
+	for _, n := range []int{0, -1} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("no panic for the limit %d", n)
+				}
+			}()
+			Concurrency(n, 0)
+		}()
+	}
+}
+
+func TestAcceptLanguage(t *testing.T) {
+	r := New()
+
+	r.Use(AcceptLanguage([]string{"en", "de", "pt-BR"}, "en"))
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, LanguageFromRequest(r))
+	})
+	r.Get("/page").Handle(h)
+	r.Get("/page/{lang}").Handle(h)
+
+	a := []struct {
+		path           string
+		acceptLanguage string
+		expected       string
+	}{
+		{"/page", "", "en"},
+		{"/page", "de", "de"},
+		{"/page", "fr, de;q=0.5, en;q=0.8", "en"},
+		{"/page", "de-AT", "de"},
+		{"/page", "PT", "pt-BR"},
+		{"/page", "pt-br", "pt-BR"},
+		{"/page", "de;q=0, fr", "en"},
+		{"/page", "fr, *;q=0.1", "en"},
+		{"/page/de", "en", "de"},
+		{"/page/fr", "de", "de"},
+	}
+	for _, v := range a {
+		headers := map[string]string{}
+		if v.acceptLanguage != "" {
+			headers["Accept-Language"] = v.acceptLanguage
+		}
+
+		resp := testRequest(r, http.MethodGet, v.path, headers, nil)
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+		assertHeader(t, resp.Header, "Vary", "Accept-Language")
+		assertBody(t, resp.Body, v.expected)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if lang := LanguageFromRequest(req); lang != "" {
+		t.Errorf("unexpected language: %s", lang)
+	}
+}
+
+func TestMaxBodySize(t *testing.T) {
+	r := New()
+
+	r.Use(MaxBodySize(10))
+
+	r.Post("/test").
+		HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+			err := r.ParseForm()
+			if errors.Is(err, ErrRequestBodyTooLarge) {
+				http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+				return
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			fmt.Fprintln(w, r.Form.Get("v"))
+		})
+
+	{
+		resp := testRequest(r, http.MethodPost, "/test", nil, map[string]string{"v": "OK"})
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+		assertBody(t, resp.Body, "OK\n")
+	}
+	{
+		resp := testRequest(r, http.MethodPost, "/test", nil, map[string]string{"v": "0123456789"})
+		assertStatus(t, resp.StatusCode, http.StatusRequestEntityTooLarge)
+	}
+	{
+		// The body size is unknown in advance, so the limit is detected by the handler.
+		req := httptest.NewRequest(http.MethodPost, "/test", io.MultiReader(strings.NewReader("v=0123456789")))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		resp := w.Result()
+		assertStatus(t, resp.StatusCode, http.StatusRequestEntityTooLarge)
+		assertBody(t, resp.Body, "request body too large (limit: 10 bytes)\n")
+	}
+	{
+		var err error
+		h := MaxBodySize(10)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, err = io.ReadAll(r.Body)
+		}))
+		req := httptest.NewRequest(http.MethodPost, "/test", io.MultiReader(strings.NewReader("0123456789a")))
+		h.ServeHTTP(httptest.NewRecorder(), req)
+
+		var maxBytesErr *http.MaxBytesError
+		if !errors.As(err, &maxBytesErr) {
+			t.Errorf("%v does not wrap *http.MaxBytesError", err)
+		} else if maxBytesErr.Limit != 10 {
+			t.Errorf("limit: %d != 10", maxBytesErr.Limit)
+		}
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	_, trusted, _ := net.ParseCIDR("10.0.0.0/8")
+	trustedProxies := []net.IPNet{*trusted}
+
+	a := []struct {
+		remoteAddr string
+		headers    map[string]string
+		expected   string
+	}{
+		{"192.0.2.1:1234", nil, "192.0.2.1"},
+		{"192.0.2.1:1234", map[string]string{"X-Forwarded-For": "198.51.100.1"}, "192.0.2.1"},
+		{"192.0.2.1:1234", map[string]string{"X-Real-IP": "198.51.100.1"}, "192.0.2.1"},
+		{"10.0.0.1:1234", map[string]string{"X-Forwarded-For": "198.51.100.1"}, "198.51.100.1"},
+		{"10.0.0.1:1234", map[string]string{"X-Forwarded-For": "203.0.113.1, 198.51.100.1, 10.0.0.2"}, "198.51.100.1"},
+		{"10.0.0.1:1234", map[string]string{"X-Forwarded-For": "10.0.0.3, 10.0.0.2"}, "10.0.0.3"},
+		{"10.0.0.1:1234", map[string]string{"X-Forwarded-For": "invalid"}, "10.0.0.1"},
+		{"10.0.0.1:1234", map[string]string{"X-Real-IP": "198.51.100.1"}, "198.51.100.1"},
+		{"10.0.0.1:1234", nil, "10.0.0.1"},
+		{"[2001:db8::1]:1234", nil, "2001:db8::1"},
+	}
+	for _, v := range a {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = v.remoteAddr
+		for k, h := range v.headers {
+			r.Header.Set(k, h)
+		}
+
+		ip := ClientIP(r, trustedProxies)
+		if ip != v.expected {
+			t.Errorf("%s %v: %s != %s", v.remoteAddr, v.headers, ip, v.expected)
+		}
+	}
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	r := New()
+
+	r.UseGlobal(SecurityHeaders(SecurityOptions{
+		FrameOptions:          "SAMEORIGIN",
+		ContentSecurityPolicy: "-",
+	}))
+
+	r.Get("/").HandleFunc(func(w http.ResponseWriter, r *http.Request) {})
+	r.Get("/embed").HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Frame-Options", "ALLOWALL")
+	})
+
+	{
+		resp := testRequest(r, http.MethodGet, "/", nil, nil)
+		assertHeader(t, resp.Header, "X-Content-Type-Options", "nosniff")
+		assertHeader(t, resp.Header, "X-Frame-Options", "SAMEORIGIN")
+		assertHeader(t, resp.Header, "Strict-Transport-Security", "max-age=31536000; includeSubDomains")
+		assertHeader(t, resp.Header, "Referrer-Policy", "strict-origin-when-cross-origin")
+		assertHeaderMissing(t, resp.Header, "Content-Security-Policy")
+	}
+	{
+		resp := testRequest(r, http.MethodGet, "/embed", nil, nil)
+		assertHeader(t, resp.Header, "X-Frame-Options", "ALLOWALL")
+	}
+	{
+		resp := testRequest(r, http.MethodGet, "/missing", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusNotFound)
+		assertHeader(t, resp.Header, "X-Content-Type-Options", "nosniff")
+	}
+}
+
+func TestCleanPath(t *testing.T) {
+	h := func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.URL.Path)
+	}
+
+	redirect := New()
+	redirect.UseGlobal(CleanPath(http.StatusMovedPermanently))
+	redirect.Get("/users/{id}").HandleFunc(h)
+
+	rewrite := New()
+	rewrite.UseGlobal(CleanPath(0))
+	rewrite.Get("/users/{id}").HandleFunc(h)
+	rewrite.Get("/files/").HandleFunc(h)
+
+	a := []struct {
+		target string
+		clean  string
+	}{
+		{"/users/1", ""},
+		{"//users//1", "/users/1"},
+		{"/users/./1", "/users/1"},
+		{"/files/../users/1?a=1", "/users/1?a=1"},
+		{"/files//", "/files/"},
+	}
+	for _, v := range a {
+		resp := testRequest(redirect, http.MethodGet, v.target, nil, nil)
+		if v.clean == "" {
+			assertStatus(t, resp.StatusCode, http.StatusOK)
+			continue
+		}
+		assertStatus(t, resp.StatusCode, http.StatusMovedPermanently)
+		assertHeader(t, resp.Header, "Location", v.clean)
+
+		resp = testRequest(rewrite, http.MethodGet, v.target, nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+		clean, _, _ := strings.Cut(v.clean, "?")
+		assertBody(t, resp.Body, clean)
+	}
+}
+
+func TestRequireHTTPS(t *testing.T) {
+	_, trusted, _ := net.ParseCIDR("10.0.0.0/8")
+	trustedProxies := []net.IPNet{*trusted}
+
+	r := New()
+	r.UseGlobal(RequireHTTPS(http.StatusMovedPermanently, trustedProxies))
+	r.Get("/page").HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "secure")
+	})
+
+	a := []struct {
+		remoteAddr string
+		tls        bool
+		proto      string
+		location   string
+	}{
+		{"192.0.2.1:1234", false, "", "https://example.com/page?a=1"},
+		{"192.0.2.1:1234", false, "https", "https://example.com/page?a=1"},
+		{"192.0.2.1:1234", true, "", ""},
+		{"10.0.0.1:1234", false, "https", ""},
+		{"10.0.0.1:1234", false, "HTTPS, http", ""},
+		{"10.0.0.1:1234", false, "http", "https://example.com/page?a=1"},
+		{"10.0.0.1:1234", false, "", "https://example.com/page?a=1"},
+	}
+	for _, v := range a {
+		req := httptest.NewRequest(http.MethodGet, "http://example.com/page?a=1", nil)
+		req.RemoteAddr = v.remoteAddr
+		if v.tls {
+			req = httptest.NewRequest(http.MethodGet, "https://example.com/page?a=1", nil)
+			req.RemoteAddr = v.remoteAddr
+		}
+		if v.proto != "" {
+			req.Header.Set("X-Forwarded-Proto", v.proto)
+		}
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		resp := w.Result()
+
+		if v.location == "" {
+			assertStatus(t, resp.StatusCode, http.StatusOK)
+			assertBody(t, resp.Body, "secure")
+		} else {
+			assertStatus(t, resp.StatusCode, http.StatusMovedPermanently)
+			assertHeader(t, resp.Header, "Location", v.location)
+		}
+	}
+}
+
+func TestRouter_AllowedMethods(t *testing.T) {
+	r := New()
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	r.Get("/articles").Handle(h)
+	r.Post("/articles").Handle(h)
+	r.Get("/articles/{id}").Where("id", regexp.MustCompile(`^\d+$`)).Handle(h)
+	r.Delete("/articles/{id}").Handle(h)
+	r.Get("/files/{path...}").Handle(h)
+
+	a := map[string]string{
+		"/articles":     "GET, POST",
+		"/articles/111": "DELETE, GET",
+		"/articles/aaa": "DELETE",
+		"/files/a/b":    "GET",
+		"/missing":      "",
+	}
+	for path, expected := range a {
+		methods := strings.Join(r.AllowedMethods(path), ", ")
+		if methods != expected {
+			t.Errorf("%s: %s != %s", path, methods, expected)
+		}
+	}
+}
+
+func TestCORSForRouter(t *testing.T) {
+	r := New()
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "OK")
+	})
+
+	r.Get("/articles").Handle(h)
+	r.Post("/articles").Handle(h)
+
+	handler := CORSForRouter(r, CORSOptions{
+		AllowedOrigins: []string{"https://example.com"},
+		MaxAge:         600,
+	})(r)
+
+	preflight := map[string]string{
+		"Origin":                         "https://example.com",
+		"Access-Control-Request-Method":  "POST",
+		"Access-Control-Request-Headers": "Content-Type",
+	}
+
+	{
+		resp := testRequest(handler, http.MethodOptions, "/articles", preflight, nil)
+		assertStatus(t, resp.StatusCode, http.StatusNoContent)
+		assertHeader(t, resp.Header, "Access-Control-Allow-Origin", "https://example.com")
+		assertHeader(t, resp.Header, "Access-Control-Allow-Methods", "GET, POST")
+		assertHeader(t, resp.Header, "Access-Control-Allow-Headers", "Content-Type")
+		assertHeader(t, resp.Header, "Access-Control-Max-Age", "600")
+	}
+	{
+		resp := testRequest(handler, http.MethodOptions, "/missing", preflight, nil)
+		assertStatus(t, resp.StatusCode, http.StatusNotFound)
+		assertHeaderMissing(t, resp.Header, "Access-Control-Allow-Methods")
+	}
+	{
+		resp := testRequest(handler, http.MethodGet, "/articles", map[string]string{"Origin": "https://example.com"}, nil)
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+		assertHeader(t, resp.Header, "Access-Control-Allow-Origin", "https://example.com")
+		assertBody(t, resp.Body, "OK\n")
+	}
+	{
+		resp := testRequest(handler, http.MethodGet, "/articles", map[string]string{"Origin": "https://example.org"}, nil)
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+		assertHeaderMissing(t, resp.Header, "Access-Control-Allow-Origin")
+	}
+}
+
+func TestResponseRecorder_Hijack(t *testing.T) {
+	r := New()
+
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(NewResponseRecorder(w), r)
+		})
+	})
+	r.Get("/ws").HandleFunc(testHijack)
+
+	assertHijacked(t, r, "/ws")
+
+	{
+		rec := NewResponseRecorder(httptest.NewRecorder())
+		_, _, err := rec.Hijack()
+		assertError(t, err, ErrHijackNotSupported)
+	}
+}
+
+// testHijack is a handler hijacking the connection to respond with 101 Switching Protocols.
+func testHijack(w http.ResponseWriter, r *http.Request) {
+	h, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "not a hijacker", http.StatusInternalServerError)
+		return
+	}
+
+	conn, rw, err := h.Hijack()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer conn.Close()
+
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: test\r\nConnection: Upgrade\r\n\r\n")
+	rw.Flush()
+}
+
+// assertHijacked checks that a request for the path is responded to by testHijack.
+func assertHijacked(t *testing.T, h http.Handler, path string) {
+	t.Helper()
+
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	fmt.Fprintf(conn, "GET %s HTTP/1.1\r\nHost: test\r\n\r\n", path)
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertStatus(t, resp.StatusCode, http.StatusSwitchingProtocols)
+	assertHeader(t, resp.Header, "Upgrade", "test")
+}
+
+func TestRoute_Disable(t *testing.T) {
+	r := New()
+
+	route := r.Get("/{id}").
+		Where("id", regexp.MustCompile(`^\d+$`)).
+		HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintln(w, "by id")
+		})
+
+	r.Get("/{name}").
+		HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintln(w, "by name")
+		})
+
+	for i := 0; i < 2; i++ {
+		{
+			resp := testRequest(r, http.MethodGet, "/111", nil, nil)
+			assertBody(t, resp.Body, "by id\n")
+		}
+
+		route.Disable()
+		{
+			resp := testRequest(r, http.MethodGet, "/111", nil, nil)
+			assertBody(t, resp.Body, "by name\n")
+		}
+
+		route.Enable()
+	}
+}
+
+func TestRouter_RemoveRoute(t *testing.T) {
+	r := New()
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "OK")
+	})
+
+	r.Prefix("/articles", func(r *Router) {
+		r.NewRoute("/{id}", http.MethodGet, http.MethodPut).
+			Name("articles.item").
+			Handle(h)
+
+		if !r.RemoveRoute(http.MethodPut, "/{id}") {
+			t.Errorf("route not removed")
+		}
+	})
+
+	if r.RemoveRoute(http.MethodPut, "/articles/{id}") {
+		t.Errorf("route removed twice")
+	}
+
+	{
+		resp := testRequest(r, http.MethodGet, "/articles/111", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+	}
+	{
+		resp := testRequest(r, http.MethodPut, "/articles/111", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusNotFound)
+	}
+
+	if _, err := r.Url("articles.item", 111); err != nil {
+		t.Error(err)
+	}
+
+	r.RemoveRoute(http.MethodGet, "/articles/{id}")
+
+	_, err := r.Url("articles.item", 111)
+	assertError(t, err, ErrRouteNotFound)
+}
+
+func TestParamsMapFromRequest(t *testing.T) {
+	r := New()
+
+	r.Get("/").
+		HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+			m := ParamsMapFromRequest(r)
+			fmt.Fprintln(w, m != nil, len(m))
+		})
+
+	r.Get("/{a}/{b}").
+		HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintln(w, ParamsMapFromRequest(r), ParamsStringMapFromRequest(r))
+		})
+
+	{
+		resp := testRequest(r, http.MethodGet, "/", nil, nil)
+		assertBody(t, resp.Body, "true 0\n")
+	}
+	{
+		resp := testRequest(r, http.MethodGet, "/x/y", nil, nil)
+		assertBody(t, resp.Body, "map[a:x b:y] map[a:x b:y]\n")
+	}
+}
+
+func TestRouter_DeepClone(t *testing.T) {
+	r := New()
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, ParamsFromRequest(r).Values())
+	})
+
+	r.Prefix("/articles", func(r *Router) {
+		r.Use(func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("X-Test", "OK")
+				next.ServeHTTP(w, r)
+			})
+		})
+
+		r.Get("/{id}").
+			Where("id", regexp.MustCompile(`^\d+$`)).
+			Name("articles.get").
+			Handle(h)
+	})
+
+	clone := r.DeepClone()
+	clone.Get("/clone").Handle(h)
+	r.Get("/orig").Handle(h)
+
+	{
+		resp := testRequest(clone, http.MethodGet, "/articles/111", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+		assertHeader(t, resp.Header, "X-Test", "OK")
+		assertBody(t, resp.Body, "[111]\n")
+	}
+	{
+		resp := testRequest(clone, http.MethodGet, "/articles/aaa", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusNotFound)
+	}
+	{
+		resp := testRequest(clone, http.MethodGet, "/clone", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+		resp = testRequest(r, http.MethodGet, "/clone", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusNotFound)
+	}
+	{
+		resp := testRequest(r, http.MethodGet, "/orig", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+		resp = testRequest(clone, http.MethodGet, "/orig", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusNotFound)
+	}
+
+	clone.Get("/test").Name("articles.get")
+
+	u, err := r.Url("articles.get", 111)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u != "/articles/111" {
+		t.Errorf("%s != %s", u, "/articles/111")
+	}
+}
+
+func TestRouter_DeepClone_notFound(t *testing.T) {
+	r := New()
+
+	r.HandleNotFound(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "custom", http.StatusNotFound)
+	}))
+	r.Prefix("/api", func(r *Router) {
+		r.Use(func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("X-Api", "1")
+				next.ServeHTTP(w, r)
+			})
+		})
+		r.Get("/users").HandleFunc(func(w http.ResponseWriter, r *http.Request) {})
+	})
+
+	clone := r.DeepClone()
+	clone.NotFoundWithPrefixMiddleware(true)
+
+	resp := testRequest(clone, http.MethodGet, "/api/missing", nil, nil)
+	assertStatus(t, resp.StatusCode, http.StatusNotFound)
+	assertHeader(t, resp.Header, "X-Api", "1")
+	assertBody(t, resp.Body, "custom\n")
+}
+
+func TestWrapJSON(t *testing.T) {
+	errArchived := errors.New("archived")
+
+	r := New()
+	r.MapError(errArchived, http.StatusGone)
+
+	r.Get("/articles/{id}").
+		Handle(r.WrapJSON(func(r *http.Request) (interface{}, error) {
+			switch id := ParamsFromRequest(r).ByName("id"); id {
+			case "1":
+				return map[string]interface{}{"id": 1, "title": "Test"}, nil
+			case "2":
+				return nil, errors.New("database is down")
+			case "4":
+				return nil, fmt.Errorf("article 4: %w", errArchived)
+			default:
+				return nil, fmt.Errorf("article %s: %w", id, &StatusError{Status: http.StatusNotFound})
+			}
+		}))
+
+	{
+		resp := testRequest(r, http.MethodGet, "/articles/1", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+		assertHeader(t, resp.Header, "Content-Type", "application/json; charset=utf-8")
+		assertBody(t, resp.Body, `{"id":1,"title":"Test"}`+"\n")
+	}
+	{
+		resp := testRequest(r, http.MethodGet, "/articles/2", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusInternalServerError)
+		assertBody(t, resp.Body, `{"error":"Internal Server Error"}`+"\n")
+	}
+	{
+		resp := testRequest(r, http.MethodGet, "/articles/3", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusNotFound)
+		assertBody(t, resp.Body, `{"error":"article 3: Not Found"}`+"\n")
+	}
+	{
+		resp := testRequest(r, http.MethodGet, "/articles/4", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusGone)
+		assertBody(t, resp.Body, `{"error":"article 4: archived"}`+"\n")
+	}
+}
+
+func TestAddParam(t *testing.T) {
+	r := New()
+
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tenant, _, _ := strings.Cut(r.Host, ".")
+			r = AddParam(r, "tenant", tenant)
+			r = AddParam(r, "id", "overridden by path")
+			next.ServeHTTP(w, r)
+		})
+	})
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, ParamsFromRequest(r))
+	})
+
+	r.Get("/articles/{id}").Handle(h)
+	r.Get("/override/{id}").Handle(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, AddParam(r, "id", "222"))
+		})
+	}(h))
+	r.Get("/replace").Handle(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, SetParams(r, Params{{Key: "a", Value: "b"}}))
+		})
+	}(h))
+
+	a := [][2]string{
+		{"http://acme.example.com/articles/111", "[{id 111} {tenant acme}]"},
+		{"http://acme.example.com/override/111", "[{id 222} {tenant acme}]"},
+		{"http://acme.example.com/replace", "[{a b}]"},
+	}
+	for _, v := range a {
+		resp := testRequest(r, http.MethodGet, v[0], nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+		assertBody(t, resp.Body, v[1])
+	}
+}
+
+func TestParams_Range(t *testing.T) {
+	params := Params{
+		{Key: "a", Value: "1"},
+		{Key: "b", Value: "2"},
+		{Key: "c", Value: "3"},
+	}
+
+	var a []string
+	params.Range(func(key, value string) bool {
+		a = append(a, key+"="+value)
+		return key != "b"
+	})
+
+	if s := strings.Join(a, ","); s != "a=1,b=2" {
+		t.Errorf("%s != %s", s, "a=1,b=2")
+	}
+
+	n := testing.AllocsPerRun(10, func() {
+		params.Range(func(key, value string) bool { return true })
+	})
+	if n > 0 {
+		t.Errorf("allocations: %v", n)
+	}
+}
+
+func TestParams_At(t *testing.T) {
+	params := Params{
+		{Key: "a", Value: "1"},
+		{Key: "b", Value: "2"},
+	}
+
+	if p, ok := params.At(1); !ok || p.Key != "b" || p.Value != "2" {
+		t.Errorf("unexpected param: %v, %v", p, ok)
+	}
+	for _, i := range []int{-1, 2} {
+		if p, ok := params.At(i); ok {
+			t.Errorf("%d: unexpected param: %v", i, p)
+		}
+		if v := params.ValueAt(i); v != "" {
+			t.Errorf("%d: unexpected value: %s", i, v)
+		}
+	}
+	if v := params.ValueAt(0); v != "1" {
+		t.Errorf("%s != %s", v, "1")
+	}
+}
+
+func TestParams_JSON(t *testing.T) {
+	r := New()
+
+	var data []byte
+	r.Get("/users/{user}/posts/{id}/{path...}").HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+		var err error
+		data, err = ParamsFromRequest(r).JSON()
+		assertError(t, err, nil)
+	})
+
+	testRequest(r, http.MethodGet, "/users/ann/posts/1/a/%22b%22", nil, nil)
+	if s := string(data); s != `{"id":"1","path":"a/\"b\"","user":"ann"}` {
+		t.Errorf("unexpected json: %s", s)
+	}
+
+	if data, _ := Params(nil).JSON(); string(data) != "{}" {
+		t.Errorf("unexpected json: %s", data)
+	}
+}
+
+func TestParams_AppendTo(t *testing.T) {
+	params := Params{
+		{Key: "id", Value: "5"},
+		{Key: "tag", Value: "b"},
+	}
+
+	v := url.Values{"tag": {"a"}, "page": {"2"}}
+	params.AppendTo(v)
+
+	if s := v.Encode(); s != "id=5&page=2&tag=a&tag=b" {
+		t.Errorf("%s != %s", s, "id=5&page=2&tag=a&tag=b")
+	}
+}
+
+func TestBindJSON(t *testing.T) {
+	type user struct {
+		Name  string `json:"name" bind:"required"`
+		Email string `json:"email,omitempty" bind:"required"`
+		Age   int    `json:"age"`
+	}
+
+	bind := func(body string) (user, error) {
+		var u user
+		req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(body))
+		return u, BindJSON(req, &u)
+	}
+
+	u, err := bind(`{"name": "Ann", "Email": "ann@example.com", "age": 30}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u != (user{Name: "Ann", Email: "ann@example.com", Age: 30}) {
+		t.Errorf("unexpected value: %+v", u)
+	}
+
+	_, err = bind(`{"name": "Ann", "email": null}`)
+	assertError(t, err, ErrMissingField)
+	if err == nil || !strings.Contains(err.Error(), "email") {
+		t.Errorf("the field is not named: %v", err)
+	}
+
+	_, err = bind(`{"name": "Ann", "email": "ann@example.com", "age": "30"}`)
+	assertError(t, err, ErrInvalidBody)
+
+	_, err = bind(`[]`)
+	assertError(t, err, ErrInvalidBody)
+
+	req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(`{}`))
+	assertError(t, BindJSON(req, user{}), ErrInvalidDestination)
+}
+
+func TestBindForm(t *testing.T) {
+	type search struct {
+		Query string   `form:"q" bind:"required"`
+		Page  int      `form:"page"`
+		Tags  []string `form:"tag"`
+		Skip  string   `form:"-"`
+	}
+
+	bind := func(target string, body string) (search, error) {
+		var s search
+		req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return s, BindForm(req, &s)
+	}
+
+	s, err := bind("/search?tag=a", "q=go&page=2&tag=b&Skip=x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprintf("%+v", s) != "{Query:go Page:2 Tags:[b a] Skip:}" {
+		t.Errorf("unexpected value: %+v", s)
+	}
+
+	_, err = bind("/search", "q=&page=2")
+	assertError(t, err, ErrMissingField)
+	if err == nil || !strings.Contains(err.Error(), "q") {
+		t.Errorf("the field is not named: %v", err)
+	}
+
+	_, err = bind("/search", "q=go&page=two")
+	assertError(t, err, ErrInvalidBody)
+	if err == nil || !strings.Contains(err.Error(), "page") {
+		t.Errorf("the field is not named: %v", err)
+	}
+}
+
+func TestParams_Scan(t *testing.T) {
+	params := Params{
+		{Key: "id", Value: "111"},
+		{Key: "draft", Value: "true"},
+		{Key: "Slug", Value: "test"},
+		{Key: "page", Value: "aaa"},
+	}
+
+	var dest struct {
+		ID    int  `param:"id"`
+		Draft bool `param:"draft"`
+		Slug  string
+		Skip  string `param:"-"`
+	}
+	err := params.Scan(&dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dest.ID != 111 || !dest.Draft || dest.Slug != "test" || dest.Skip != "" {
+		t.Errorf("invalid result: %+v", dest)
+	}
+
+	var invalid struct {
+		Page uint `param:"page"`
+	}
+	err = params.Scan(&invalid)
+	assertError(t, err, ErrInvalidParameter)
+	if err != nil && !strings.Contains(err.Error(), "field Page, parameter page") {
+		t.Errorf("invalid error: %v", err)
+	}
+
+	err = params.Scan(dest)
+	assertError(t, err, ErrInvalidDestination)
+}
+
+func TestRouter_MarshalRoutes(t *testing.T) {
+	r := New()
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	r.Prefix("/articles", func(r *Router) {
+		r.NewRoute("/{id}", http.MethodPut, http.MethodGet).
+			Where("id", regexp.MustCompile(`^\d+$`)).
+			Name("articles.item").
+			Handle(h)
+
+		r.Post("").Handle(h)
+		r.Get("")
+	})
+
+	b, err := r.MarshalRoutes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `[` +
+		`{"methods":["GET"],"pattern":"/articles","conditions":false,"handler":false},` +
+		`{"methods":["POST"],"pattern":"/articles","conditions":false,"handler":true},` +
+		`{"methods":["GET","PUT"],"pattern":"/articles/{id}","name":"articles.item","conditions":true,"handler":true}` +
+		`]`
+	if string(b) != expected {
+		t.Errorf("\ngot:      %s\nexpected: %s", b, expected)
+	}
+}
+
+func TestRouter_DebugEndpoint(t *testing.T) {
+	r := New()
+
+	r.Get("/slow").Name("slow").HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(10 * time.Millisecond)
+	})
+	r.Get("/fast").HandleFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	testRequest(r, http.MethodGet, "/fast", nil, nil)
+
+	r.DebugEndpoint("/debug/routes").SkipMiddleware()
+
+	testRequest(r, http.MethodGet, "/slow", nil, nil)
+	testRequest(r, http.MethodGet, "/fast", nil, nil)
+	testRequest(r, http.MethodGet, "/fast", nil, nil)
+
+	resp := testRequest(r, http.MethodGet, "/debug/routes", nil, nil)
+	assertStatus(t, resp.StatusCode, http.StatusOK)
+	assertHeader(t, resp.Header, "Content-Type", "text/plain; charset=utf-8")
+
+	b, _ := ioutil.ReadAll(resp.Body)
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("unexpected output:\n%s", b)
+	}
+
+	expected := [][]string{
+		{"METHODS", "PATTERN", "NAME", "MIDDLEWARE", "REQUESTS", "LAST", "LATENCY"},
+		{"GET", "/debug/routes", "-", "0", "0", "0s"},
+		{"GET", "/fast", "-", "0", "2"},
+		{"GET", "/slow", "slow", "0", "1"},
+	}
+	for i, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) < len(expected[i]) || fmt.Sprint(fields[:len(expected[i])]) != fmt.Sprint(expected[i]) {
+			t.Errorf("unexpected line: %s", line)
+		}
+	}
+
+	latency, err := time.ParseDuration(strings.Fields(lines[3])[5])
+	if err != nil || latency < 10*time.Millisecond {
+		t.Errorf("unexpected latency: %s", lines[3])
+	}
+}
+
+func TestRoute_SkipMiddleware_matchedOnce(t *testing.T) {
+	for _, timeout := range []time.Duration{0, time.Second} {
+		r := New()
+		r.SetTimeout(timeout)
+
+		calls := make(map[string]int)
+		condition := func(name string, result bool) func(*http.Request) bool {
+			return func(*http.Request) bool {
+				calls[name]++
+				return result
+			}
+		}
+
+		r.Use(func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("X-Middleware", "1")
+				next.ServeHTTP(w, r)
+			})
+		})
+
+		r.Get("/{id}").WhereRequest(condition("health", false)).SkipMiddleware().
+			HandleFunc(func(w http.ResponseWriter, r *http.Request) {})
+		r.Get("/{id}").WhereRequest(condition("item", true)).
+			HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, ParamsFromRequest(r).ByName("id"))
+			})
+
+		resp := testRequest(r, http.MethodGet, "/1", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+		assertHeader(t, resp.Header, "X-Middleware", "1")
+		assertBody(t, resp.Body, "1")
+
+		if s := fmt.Sprint(calls); s != "map[health:1 item:1]" {
+			t.Errorf("timeout %s: unexpected calls: %s", timeout, s)
+		}
+	}
+}
+
+func TestRoute_MiddlewareCount(t *testing.T) {
+	r := New()
+
+	m := func(next http.Handler) http.Handler {
+		return next
+	}
+
+	r.Use(m)
+
+	index := r.Get("/")
+	var item, itemPut, health *Route
+	r.Prefix("/articles", func(r *Router) {
+		r.Use(m, m)
+		item = r.Get("/{id}")
+		health = r.Get("/{id}/health").SkipMiddleware()
+	})
+	r.Group(func(r *Router) {
+		r.Use(m, m, m)
+		itemPut = r.NewRoute("/articles/{id}", http.MethodPut, http.MethodGet)
+	})
+
+	a := []struct {
+		route    *Route
+		expected int
+	}{
+		{index, 1},
+		{item, 3},
+		{itemPut, 4},
+		{health, 0},
+	}
+	for _, v := range a {
+		if n := v.route.MiddlewareCount(); n != v.expected {
+			t.Errorf("%s: %d != %d", v.route, n, v.expected)
+		}
+	}
+}
+
+func TestRouter_PrintRoutes(t *testing.T) {
+	r := New()
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	m := func(next http.Handler) http.Handler {
+		return next
+	}
+
+	r.Get("/").Name("index").Handle(h)
+	r.Prefix("/articles", func(r *Router) {
+		r.Use(m, m)
+		r.NewRoute("/{id}", http.MethodPut, http.MethodGet).Name("articles.item").Handle(h)
+	})
+
+	buf := new(bytes.Buffer)
+	if err := r.PrintRoutes(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "" +
+		"METHODS  PATTERN         NAME           MIDDLEWARE\n" +
+		"GET      /               index          0\n" +
+		"GET,PUT  /articles/{id}  articles.item  2\n"
+	assertBody(t, buf, expected)
+}
+
+func TestRoute_Deprecated(t *testing.T) {
+	r := New()
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	sunset := time.Date(2030, time.January, 2, 15, 4, 5, 0, time.UTC)
+
+	r.Get("/v1").Handle(h).Deprecated(sunset)
+	r.Get("/v2").Handle(h).Deprecated(time.Time{})
+	r.Get("/v3").Handle(h)
+
+	{
+		resp := testRequest(r, http.MethodGet, "/v1", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+		assertHeader(t, resp.Header, "Deprecation", "true")
+		assertHeader(t, resp.Header, "Sunset", "Wed, 02 Jan 2030 15:04:05 GMT")
+	}
+	{
+		resp := testRequest(r, http.MethodGet, "/v2", nil, nil)
+		assertHeader(t, resp.Header, "Deprecation", "true")
+		assertHeaderMissing(t, resp.Header, "Sunset")
+	}
+	{
+		resp := testRequest(r, http.MethodGet, "/v3", nil, nil)
+		assertHeaderMissing(t, resp.Header, "Deprecation")
+	}
+
+	b, err := r.MarshalRoutes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `[` +
+		`{"methods":["GET"],"pattern":"/v1","conditions":false,"handler":true,"deprecated":true,"sunset":"2030-01-02T15:04:05Z"},` +
+		`{"methods":["GET"],"pattern":"/v2","conditions":false,"handler":true,"deprecated":true},` +
+		`{"methods":["GET"],"pattern":"/v3","conditions":false,"handler":true}` +
+		`]`
+	if string(b) != expected {
+		t.Errorf("\ngot:      %s\nexpected: %s", b, expected)
+	}
+
+	if _, ok := r.OpenAPIPaths()["/v1"].(map[string]interface{})["get"].(map[string]interface{})["deprecated"]; !ok {
+		t.Error("deprecated operation is not marked")
+	}
+}
+
+func TestRouter_OpenAPIPaths(t *testing.T) {
+	r := New()
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	r.Get("/articles").Name("articles.index").Handle(h)
+	r.NewRoute("/articles/{id}", http.MethodGet, http.MethodDelete).
+		Where("id", regexp.MustCompile(`^\d+$`)).
+		Name("articles.item").
+		Handle(h)
+	r.Get("/files/{path...}").Handle(h)
+	r.Get("/draft")
+	r.NewRoute("/tunnel", http.MethodConnect).Name("tunnel").Handle(h)
+
+	b, err := json.Marshal(r.OpenAPIPaths())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parameter := func(name string) string {
+		return `{"in":"path","name":"` + name + `","required":true,"schema":{"type":"string"}}`
+	}
+	parameterID := `{"in":"path","name":"id","required":true,"schema":{"pattern":"^\\d+$","type":"string"}}`
+	responses := `"responses":{"default":{"description":"Default response"}}`
+
+	expected := `{` +
+		`"/articles":{"get":{"operationId":"articles.index",` + responses + `}},` +
+		`"/articles/{id}":{` +
+		`"delete":{"operationId":"articles.item.delete","parameters":[` + parameterID + `],` + responses + `},` +
+		`"get":{"operationId":"articles.item.get","parameters":[` + parameterID + `],` + responses + `}},` +
+		`"/files/{path}":{"get":{"parameters":[` + parameter("path") + `],` + responses + `}}` +
+		`}`
+	if string(b) != expected {
+		t.Errorf("\ngot:      %s\nexpected: %s", b, expected)
+	}
+}
+
+func TestRouter_GenerateUrls(t *testing.T) {
+	r := New()
+
+	r.Get("/").Name("index")
+	r.Get("/articles/{id}").Name("articles.get").Where("id", regexp.MustCompile(`^\d+$`))
+	r.Get("/users/{name}/{tab}").Name("users.tab")
+	r.Get("/tags/{id}").Name("tags.get").Where("id", regexp.MustCompile(`^[a-z]+$`))
+	r.Get("/unnamed/{id}")
+
+	urls, err := r.GenerateUrls(func(routeName string, paramName string) interface{} {
+		switch paramName {
+		case "id":
+			return 111
+		case "name":
+			return "test"
+		default:
+			return routeName
+		}
+	})
+
+	expected := map[string]string{
+		"index":        "/",
+		"articles.get": "/articles/111",
+		"users.tab":    "/users/test/users.tab",
+	}
+	if fmt.Sprint(urls) != fmt.Sprint(expected) {
+		t.Errorf("urls: %v != %v", urls, expected)
+	}
+
+	var validationError *ValidationError
+	if !errors.As(err, &validationError) || len(validationError.Errors) != 1 {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !errors.Is(err, ErrInvalidParameter) {
+		t.Errorf("%v is not %v", err, ErrInvalidParameter)
+	}
+	if !strings.HasPrefix(err.Error(), "tags.get: ") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestUrlResolver(t *testing.T) {
+	users := New()
+	users.Get("/users/{id}").Name("users.get")
+
+	articles := New()
+	articles.Get("/articles/{id}").Name("articles.get")
+
+	resolver, err := NewUrlResolver(users, articles)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	{
+		u, err := resolver.Url("users.get", 111)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if u != "/users/111" {
+			t.Errorf("%s != %s", u, "/users/111")
+		}
+	}
+	{
+		u, err := resolver.Url("articles.get", 222)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if u != "/articles/222" {
+			t.Errorf("%s != %s", u, "/articles/222")
+		}
+	}
+	{
+		_, err := resolver.Url("missing")
+		assertError(t, err, ErrRouteNotFound)
+	}
+
+	other := New()
+	other.Get("/other/users/{id}").Name("users.get")
+
+	err = resolver.Add(other)
+	assertError(t, err, ErrDuplicateName)
+	_, err = NewUrlResolver(users, other)
+	assertError(t, err, ErrDuplicateName)
+
+	articles.Get("/articles/{id}/users").Name("users.get")
+
+	_, err = resolver.Url("users.get", 111)
+	assertError(t, err, ErrDuplicateName)
+}
+
+func TestRouter_Validate(t *testing.T) {
+	r := New()
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	r.Get("/{name}").Name("test").Handle(h)
+	r.Get("/{id}").Where("id", regexp.MustCompile(`^\d+$`)).Handle(h)
+	r.Post("/articles").Name("test")
+
+	err := r.Validate()
+	assertError(t, err, ErrNoHandler)
+	assertError(t, err, ErrDuplicateName)
+	assertError(t, err, ErrShadowedRoute)
+
+	expected := "" +
+		"POST /articles: no handler\n" +
+		"test: duplicate route name (POST /articles; GET /{name})\n" +
+		"GET /{id}: route is shadowed by GET /{name}"
+	if err != nil && err.Error() != expected {
+		t.Errorf("\ngot:\n%s\nexpected:\n%s", err, expected)
+	}
+
+	r = New()
+	r.Get("/{id}").Where("id", regexp.MustCompile(`^\d+$`)).Name("a").Handle(h)
+	r.Get("/{name}").Handle(h)
+
+	if err := r.Validate(); err != nil {
+		t.Error(err)
+	}
+
+	r = New()
+	r.Get("/users/{id}").Where("id", regexp.MustCompile(`^\d+$`)).Name("users.get").Handle(h)
+	r.Get("/users/{name}").Name("users.byName").Handle(h)
+
+	err = r.Validate()
+	assertError(t, err, ErrMissingCondition)
+
+	expected = "GET /users/{name}: name: parameter has no conditions (matched by GET /users/{id})"
+	if err != nil && err.Error() != expected {
+		t.Errorf("\ngot:\n%s\nexpected:\n%s", err, expected)
+	}
+}
+
+func TestJSONNotFound(t *testing.T) {
+	r := New()
+
+	r.HandleNotFound(JSONNotFound())
+	r.HandleMethodNotAllowed(JSONMethodNotAllowed())
+
+	r.Get("/test").
+		HandleFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	{
+		resp := testRequest(r, http.MethodGet, "/missing", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusNotFound)
+		assertHeader(t, resp.Header, "Content-Type", "application/json; charset=utf-8")
+		assertBody(t, resp.Body, `{"error":"not found"}`+"\n")
+	}
+	{
+		resp := testRequest(r, http.MethodPost, "/test", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusMethodNotAllowed)
+		assertHeader(t, resp.Header, "Content-Type", "application/json; charset=utf-8")
+		assertBody(t, resp.Body, `{"error":"method not allowed"}`+"\n")
+	}
+}
+
+func TestRoute_RedirectTo(t *testing.T) {
+	r := New()
+
+	r.Get("/old").RedirectTo("/new", http.StatusMovedPermanently)
+	r.Get("/about").RedirectToRoute("pages.get", http.StatusFound, "about")
+	r.Get("/broken").RedirectToRoute("missing", http.StatusFound)
+
+	r.Get("/pages/{name}").Name("pages.get")
+
+	{
+		resp := testRequest(r, http.MethodGet, "/old", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusMovedPermanently)
+		assertHeader(t, resp.Header, "Location", "/new")
+	}
+	{
+		resp := testRequest(r, http.MethodGet, "/about", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusFound)
+		assertHeader(t, resp.Header, "Location", "/pages/about")
+	}
+	{
+		resp := testRequest(r, http.MethodGet, "/broken", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusInternalServerError)
+	}
+}
+
+func TestRouter_NotFoundHere(t *testing.T) {
+	r := New()
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "found")
+	})
+	notFound := func(s string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, s)
+		})
+	}
+
+	r.Prefix("/api", func(r *Router) {
+		r.Use(func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("X-Test", "OK")
+				next.ServeHTTP(w, r)
+			})
+		})
+
+		r.Prefix("/users/{id}", func(r *Router) {
+			r.NotFoundHere(notFound("user not found"))
+			r.Get("/profile").Handle(h)
+		})
+
+		r.NotFoundHere(notFound("api not found"))
+		r.Get("/articles").Handle(h)
+		r.Get("/articles/{id}").Handle(h).Where("id", regexp.MustCompile(`^\d+$`))
+	})
+
+	r.HandleNotFound(notFound("not found"))
+
+	a := []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{"/api/articles", http.StatusOK, "found"},
+		{"/api/articles/111", http.StatusOK, "found"},
+		{"/api/articles/abc", http.StatusNotFound, "api not found"},
+		{"/api/missing", http.StatusNotFound, "api not found"},
+		{"/api", http.StatusNotFound, "api not found"},
+		{"/api/users/111/profile", http.StatusOK, "found"},
+		{"/api/users/111/missing", http.StatusNotFound, "user not found"},
+		{"/apiary", http.StatusNotFound, "not found"},
+		{"/missing", http.StatusNotFound, "not found"},
+	}
+	for _, v := range a {
+		resp := testRequest(r, http.MethodGet, v.path, nil, nil)
+		assertStatus(t, resp.StatusCode, v.status)
+		assertBody(t, resp.Body, v.body)
+		if strings.HasPrefix(v.path, "/api/") {
+			assertHeader(t, resp.Header, "X-Test", "OK")
+		}
+	}
+
+	resp := testRequest(r.DeepClone(), http.MethodGet, "/api/users/111/missing", nil, nil)
+	assertBody(t, resp.Body, "user not found")
+
+	resp = testRequest(r, http.MethodPost, "/api/articles", nil, nil)
+	assertStatus(t, resp.StatusCode, http.StatusMethodNotAllowed)
+}
+
+func TestRouter_Fallback(t *testing.T) {
+	r := New()
+
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Test", "OK")
+			next.ServeHTTP(w, r)
+		})
+	})
+
+	r.Fallback(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "fallback: %s\n", ParamsFromRequest(r).ByName("path"))
+	}))
+
+	r.Get("/articles/{id}").
+		Where("id", regexp.MustCompile(`^\d+$`)).
+		HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintln(w, "article")
+		})
+
+	for path, body := range map[string]string{
+		"/articles/111": "article\n",
+		"/articles/aaa": "fallback: articles/aaa\n",
+		"/a/b/c":        "fallback: a/b/c\n",
+	} {
+		resp := testRequest(r, http.MethodGet, path, nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+		assertHeader(t, resp.Header, "X-Test", "OK")
+		assertBody(t, resp.Body, body)
+	}
+}
+
+func TestETag(t *testing.T) {
+	r := New()
+
+	r.Use(ETag(10))
+
+	r.Get("/small").
+		HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintln(w, "small")
+		})
+
+	r.Get("/large").
+		HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintln(w, "large response")
+		})
+
+	var etag string
+	{
+		resp := testRequest(r, http.MethodGet, "/small", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+		assertBody(t, resp.Body, "small\n")
+
+		etag = resp.Header.Get("ETag")
+		if len(etag) != 34 {
+			t.Errorf("invalid ETag: %s", etag)
+		}
+	}
+	{
+		resp := testRequest(r, http.MethodGet, "/small", map[string]string{"If-None-Match": etag}, nil)
+		assertStatus(t, resp.StatusCode, http.StatusNotModified)
+		assertBody(t, resp.Body, "")
+	}
+	{
+		resp := testRequest(r, http.MethodGet, "/small", map[string]string{"If-None-Match": `"other"`}, nil)
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+		assertBody(t, resp.Body, "small\n")
+	}
+	{
+		resp := testRequest(r, http.MethodGet, "/large", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+		assertHeaderMissing(t, resp.Header, "Etag")
+		assertBody(t, resp.Body, "large response\n")
+	}
+}
+
+func TestETag_hijack(t *testing.T) {
+	r := New()
+
+	r.Use(ETag(1024))
+	r.Get("/ws").HandleFunc(testHijack)
+
+	assertHijacked(t, r, "/ws")
+
+	w := ETag(1024)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := w.(interface{ Unwrap() http.ResponseWriter }); !ok {
+			t.Error("the writer cannot be unwrapped")
+		}
+	}))
+	w.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+}
+
+func TestETag_head(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "file.txt"), []byte("content"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	r := New()
+
+	r.Use(ETag(1024))
+	r.NewRoute("/file", http.MethodGet, http.MethodHead).
+		HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.ServeFile(w, r, filepath.Join(dir, "file.txt"))
+		})
+	r.NewRoute("/tagged", http.MethodGet, http.MethodHead).
+		HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("ETag", `"v1"`)
+			fmt.Fprint(w, "tagged")
+		})
+
+	{
+		resp := testRequest(r, http.MethodGet, "/file", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+		if etag := resp.Header.Get("ETag"); etag == "" {
+			t.Error("no ETag for GET")
+		}
+
+		resp = testRequest(r, http.MethodHead, "/file", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+		assertHeaderMissing(t, resp.Header, "Etag")
+	}
+	for _, method := range []string{http.MethodGet, http.MethodHead} {
+		resp := testRequest(r, method, "/tagged", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+		assertHeader(t, resp.Header, "Etag", `"v1"`)
+	}
+}
+
+func TestLastModified(t *testing.T) {
+	modTime := time.Date(2024, 5, 1, 12, 0, 0, 500, time.UTC)
+
+	r := New()
+
+	r.Use(LastModified(func(r *http.Request) (time.Time, bool) {
+		return modTime, r.URL.Path == "/users/1"
+	}))
+
+	r.Get("/users/{id}").
+		HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, "user")
+		})
+
+	lastModified := "Wed, 01 May 2024 12:00:00 GMT"
+	tests := []struct {
+		path            string
+		ifModifiedSince string
+		status          int
+		body            string
+	}{
+		{"/users/1", "", http.StatusOK, "user"},
+		{"/users/1", lastModified, http.StatusNotModified, ""},
+		{"/users/1", "Thu, 02 May 2024 12:00:00 GMT", http.StatusNotModified, ""},
+		{"/users/1", "Tue, 30 Apr 2024 12:00:00 GMT", http.StatusOK, "user"},
+		{"/users/1", "invalid", http.StatusOK, "user"},
+	}
+	for _, test := range tests {
+		resp := testRequest(r, http.MethodGet, test.path, map[string]string{"If-Modified-Since": test.ifModifiedSince}, nil)
+		assertStatus(t, resp.StatusCode, test.status)
+		assertHeader(t, resp.Header, "Last-Modified", lastModified)
+		assertBody(t, resp.Body, test.body)
+	}
+	{
+		resp := testRequest(r, http.MethodGet, "/users/1", map[string]string{
+			"If-Modified-Since": lastModified,
+			"If-None-Match":     `"other"`,
+		}, nil)
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+	}
+	{
+		resp := testRequest(r, http.MethodGet, "/users/2", map[string]string{"If-Modified-Since": lastModified}, nil)
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+		assertHeaderMissing(t, resp.Header, "Last-Modified")
+	}
+}
+
+func TestRouter_FileRoutes(t *testing.T) {
+	dir := t.TempDir()
+
+	files := []string{
+		"index.html",
+		"about.html",
+		"articles/index.go",
+		"articles/[id].[format].go",
+		"files/[...path].go",
+		"users/[id]/profile.go",
+		"_partials/header.html",
+		".hidden",
+		"skipped.txt",
+	}
+	for _, name := range files {
+		name = filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := New()
+
+	err := r.FileRoutes(dir, func(relpath string) http.Handler {
+		if strings.HasSuffix(relpath, ".txt") {
+			return nil
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "%s %v", relpath, ParamsFromRequest(r).Map())
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := [][2]string{
+		{"/", "index.html map[]"},
+		{"/about", "about.html map[]"},
+		{"/articles", "articles/index.go map[]"},
+		{"/articles/111.json", "articles/[id].[format].go map[format:json id:111]"},
+		{"/files/a/b", "files/[...path].go map[path:a/b]"},
+		{"/users/111/profile", "users/[id]/profile.go map[id:111]"},
+	}
+	for _, v := range a {
+		resp := testRequest(r, http.MethodGet, v[0], nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+		assertBody(t, resp.Body, v[1])
+	}
+
+	for _, path := range []string{"/_partials/header", "/.hidden", "/skipped"} {
+		resp := testRequest(r, http.MethodGet, path, nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusNotFound)
+	}
+
+	if err := r.FileRoutes(filepath.Join(dir, "missing"), nil); err == nil {
+		t.Error("no error for a missing directory")
+	}
+
+	if err := os.MkdirAll(filepath.Join(dir, "conflict"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"[id].go", "new.go"} {
+		if err := os.WriteFile(filepath.Join(dir, "conflict", name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = New().FileRoutes(filepath.Join(dir, "conflict"), func(relpath string) http.Handler {
+		return http.NotFoundHandler()
+	})
+	if err == nil || !strings.HasPrefix(err.Error(), "new.go: conflicting routes:") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestRouter_Route(t *testing.T) {
+	r := New()
+
+	handler := func(name string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "%s %s", name, ParamsFromRequest(r).ByName("id"))
+		})
+	}
+
+	pr := r.Route("/pages/{id}/form").
+		GetNamed("page.show", handler("show")).
+		Where("id", regexp.MustCompile(`^\d+$`)).
+		PostNamed("page.submit", handler("submit"))
+
+	if routes := pr.Routes(); len(routes) != 2 || routes[0].GetName() != "page.show" || routes[1].GetName() != "page.submit" {
+		t.Errorf("unexpected routes: %v", routes)
+	}
+
+	for name, method := range map[string]string{"page.show": http.MethodGet, "page.submit": http.MethodPost} {
+		u, err := r.Url(name, 1)
+		assertError(t, err, nil)
+		if u != "/pages/1/form" {
+			t.Errorf("unexpected url: %s", u)
+		}
+
+		mu, err := r.UrlForMethod(name, method, 1)
+		assertError(t, err, nil)
+		if mu != u {
+			t.Errorf("unexpected url: %s", mu)
+		}
+	}
+
+	tests := []struct {
+		method string
+		path   string
+		status int
+		body   string
+	}{
+		{http.MethodGet, "/pages/1/form", http.StatusOK, "show 1"},
+		{http.MethodPost, "/pages/1/form", http.StatusOK, "submit 1"},
+		{http.MethodGet, "/pages/a/form", http.StatusNotFound, "404 page not found\n"},
+		{http.MethodPost, "/pages/a/form", http.StatusNotFound, "404 page not found\n"},
+	}
+	for _, test := range tests {
+		resp := testRequest(r, test.method, test.path, nil, nil)
+		assertStatus(t, resp.StatusCode, test.status)
+		assertBody(t, resp.Body, test.body)
+	}
+
+	assertError(t, r.Validate(), nil)
+}
+
+func TestRouter_Methods(t *testing.T) {
+	r := New()
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s %s", r.Method, r.URL.Path)
+	})
+
+	api := r.Methods("PROPFIND", http.MethodGet)
+	a := api.Handle("/a/{id}", h).Where("id", regexp.MustCompile(`^\d+$`)).Name("a")
+	b := api.HandleFunc("/b/{id}", h).Name("b")
+
+	if fmt.Sprint(a.Methods(), b.Methods()) != "[PROPFIND GET] [PROPFIND GET]" {
+		t.Errorf("unexpected methods: %v, %v", a.Methods(), b.Methods())
+	}
+
+	{
+		resp := testRequest(r, "PROPFIND", "/a/111", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+		assertBody(t, resp.Body, "PROPFIND /a/111")
+	}
+	{
+		resp := testRequest(r, http.MethodGet, "/a/abc", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusNotFound)
+	}
+	{
+		resp := testRequest(r, http.MethodGet, "/b/abc", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+	}
+	{
+		resp := testRequest(r, http.MethodPost, "/b/abc", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusMethodNotAllowed)
+	}
+
+	u, err := r.Url("b", "abc")
+	if err != nil || u != "/b/abc" {
+		t.Errorf("unexpected url: %s, %v", u, err)
+	}
+}
+
+func TestRouter_catchAllSiblings_middleware(t *testing.T) {
+	r := New()
+
+	h := func(w http.ResponseWriter, r *http.Request) {}
+	r.Get("/a").HandleFunc(h)
+	r.Get("/api/{path...}").HandleFunc(h)
+
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Later", "1")
+			next.ServeHTTP(w, r)
+		})
+	})
+	r.Get("/api/users").HandleFunc(h)
+
+	for _, r := range []*Router{r, r.DeepClone()} {
+		for _, path := range []string{"/a", "/api/a/b"} {
+			resp := testRequest(r, http.MethodGet, path, nil, nil)
+			assertStatus(t, resp.StatusCode, http.StatusOK)
+			assertHeaderMissing(t, resp.Header, "X-Later")
+		}
+		{
+			resp := testRequest(r, http.MethodGet, "/api/users", nil, nil)
+			assertStatus(t, resp.StatusCode, http.StatusOK)
+			assertHeader(t, resp.Header, "X-Later", "1")
+		}
+	}
+}
+
+func TestRouter_catchAllSiblings(t *testing.T) {
+	h := func(name string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "%s %s", name, ParamsStringMapFromRequest(r))
+		})
+	}
+
+	build := func(catchAllFirst bool) *Router {
+		r := New()
+		if catchAllFirst {
+			r.Get("/api/{rest...}").Handle(h("rest"))
+		}
+		r.Get("/api/users").Handle(h("users"))
+		r.Get("/api/users/{id}").Handle(h("user"))
+		if !catchAllFirst {
+			r.Get("/api/{rest...}").Handle(h("rest"))
+		}
+		return r
+	}
+
+	for _, catchAllFirst := range []bool{true, false} {
+		r := build(catchAllFirst)
+
+		for _, r := range []*Router{r, r.DeepClone()} {
+			{
+				resp := testRequest(r, http.MethodGet, "/api/users", nil, nil)
+				assertStatus(t, resp.StatusCode, http.StatusOK)
+				assertBody(t, resp.Body, "users map[]")
+			}
+			{
+				resp := testRequest(r, http.MethodGet, "/api/users/5", nil, nil)
+				assertStatus(t, resp.StatusCode, http.StatusOK)
+				assertBody(t, resp.Body, "user map[id:5]")
+			}
+			{
+				resp := testRequest(r, http.MethodGet, "/api/anything-else", nil, nil)
+				assertStatus(t, resp.StatusCode, http.StatusOK)
+				assertBody(t, resp.Body, "rest map[rest:anything-else]")
+			}
+			{
+				resp := testRequest(r, http.MethodGet, "/api/a/b", nil, nil)
+				assertStatus(t, resp.StatusCode, http.StatusOK)
+				assertBody(t, resp.Body, "rest map[rest:a/b]")
+			}
+			{
+				resp := testRequest(r, http.MethodGet, "/other", nil, nil)
+				assertStatus(t, resp.StatusCode, http.StatusNotFound)
+			}
+		}
+
+		if methods := r.AllowedMethods("/api/x/y"); fmt.Sprint(methods) != "[GET]" {
+			t.Errorf("unexpected methods: %v", methods)
+		}
+	}
+}
+
+func TestRouter_catchAllSiblings_otherMethods(t *testing.T) {
+	r := New()
+
+	r.NewRoute("/files/{path...}", http.MethodGet, http.MethodHead).
+		HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, "file ", ParamsFromRequest(r).ByName("path"))
+		})
+	r.Get("/files/info").HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "info")
+	})
+
+	{
+		resp := testRequest(r, http.MethodGet, "/files/a.txt", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+		assertHeaderMissing(t, resp.Header, "Allow")
+		assertBody(t, resp.Body, "file a.txt")
+	}
+	{
+		resp := testRequest(r, http.MethodGet, "/files/info", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+		assertBody(t, resp.Body, "info")
+	}
+
+	if result := r.DryRun(http.MethodGet, "/files/a.txt", nil); result.Status != http.StatusOK {
+		t.Errorf("unexpected status: %d", result.Status)
+	}
+}
+
+func TestRouter_catchAllSiblings_notFound(t *testing.T) {
+	r := New()
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	r.Get("/api/users").Handle(h)
+	r.Get("/api/{rest...}").Handle(h)
+
+	tests := []struct {
+		method   string
+		path     string
+		status   int
+		allow    string
+		location string
+	}{
+		{http.MethodPost, "/api/other", http.StatusMethodNotAllowed, "GET, OPTIONS", ""},
+		{http.MethodPost, "/api/users", http.StatusMethodNotAllowed, "GET, OPTIONS", ""},
+		{http.MethodOptions, "/api/other", http.StatusOK, "GET, OPTIONS", ""},
+		{http.MethodGet, "/api", http.StatusMovedPermanently, "", "/api/"},
+		{http.MethodPost, "/other", http.StatusNotFound, "", ""},
+	}
+	for _, r := range []*Router{r, r.DeepClone()} {
+		for _, test := range tests {
+			resp := testRequest(r, test.method, test.path, nil, nil)
+			assertStatus(t, resp.StatusCode, test.status)
+			if test.allow != "" {
+				assertHeader(t, resp.Header, "Allow", test.allow)
+			} else {
+				assertHeaderMissing(t, resp.Header, "Allow")
+			}
+			if test.location != "" {
+				assertHeader(t, resp.Header, "Location", test.location)
+			}
+		}
+	}
+}
+
+func TestRouter_conflictingRoutes(t *testing.T) {
+	r := New()
+
+	r.Get("/users/{id}")
+	r.Get("/users/{name}")
+	r.Post("/users/new")
+
+	defer func() {
+		rcv := recover()
+		s, _ := rcv.(string)
+		if !strings.Contains(s, "GET /users/new and GET /users/{id}") {
+			t.Errorf("unexpected panic: %v", rcv)
+		}
+		if _, ok := r.routes[http.MethodGet]["/users/new"]; ok {
+			t.Error("the conflicting pattern is not removed")
+		}
+	}()
+	r.Get("/users/new")
+}
+
+func TestRouter_NotFoundWithPrefixMiddleware(t *testing.T) {
+	r := New()
+
+	var log []string
+	sink := func(s string) { log = append(log, s) }
+
+	r.Use(Tap("root", sink))
+	r.HandleNotFound(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sink("not found")
+		http.NotFound(w, r)
+	}))
+
+	r.Prefix("/api", func(r *Router) {
+		r.Use(Tap("api", sink))
+		r.Get("/users").HandleFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+		r.Prefix("/admin", func(r *Router) {
+			r.Get("/stats").HandleFunc(func(w http.ResponseWriter, r *http.Request) {})
+			r.Use(Tap("admin", sink))
+		})
+		r.Prefix("/docs", func(r *Router) {
+			r.NotFoundHere(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				sink("docs")
+				http.NotFound(w, r)
+			}))
+		})
+	})
+
+	a := map[string]string{
+		"/missing":             "enter root,not found,exit root",
+		"/api/missing":         "enter root,enter api,not found,exit api,exit root",
+		"/api":                 "enter root,enter api,not found,exit api,exit root",
+		"/api/admin/x":         "enter root,enter api,enter admin,not found,exit admin,exit api,exit root",
+		"/api/administrator/x": "enter root,enter api,not found,exit api,exit root",
+		"/api/docs/x":          "enter root,enter api,docs,exit api,exit root",
+	}
+
+	testRequest(r, http.MethodGet, "/api/admin/x", nil, nil)
+	if s := strings.Join(log, ","); s != "enter root,not found,exit root" {
+		t.Errorf("%s != %s", s, "enter root,not found,exit root")
+	}
+
+	r.NotFoundWithPrefixMiddleware(true)
+
+	for _, r := range []*Router{r, r.DeepClone()} {
+		for path, expected := range a {
+			log = nil
+			resp := testRequest(r, http.MethodGet, path, nil, nil)
+			assertStatus(t, resp.StatusCode, http.StatusNotFound)
+			if s := strings.Join(log, ","); s != expected {
+				t.Errorf("%s: %s != %s", path, s, expected)
+			}
+		}
+	}
+}
+
+func TestRouter_Handle(t *testing.T) {
+	r := New()
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s %s\n", r.Method, r.URL.Path)
+	})
+
+	r.Handle("/full", h, false)
+
+	r.Prefix("/users/{id}", func(r *Router) {
+		r.Use(func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("X-Test", "OK")
+				next.ServeHTTP(w, r)
+			})
+		})
+
+		r.Handle("/files/", h, true)
+	})
+
+	{
+		resp := testRequest(r, http.MethodGet, "/full/a/b", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+		assertBody(t, resp.Body, "GET /full/a/b\n")
+	}
+	{
+		resp := testRequest(r, http.MethodPost, "/users/111/files/a/b", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+		assertHeader(t, resp.Header, "X-Test", "OK")
+		assertBody(t, resp.Body, "POST /a/b\n")
+	}
+	{
+		resp := testRequest(r, http.MethodGet, "/users/111/files/", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+		assertBody(t, resp.Body, "GET /\n")
+	}
+	{
+		resp := testRequest(r, http.MethodGet, "/users/111/files/dir/", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+		assertBody(t, resp.Body, "GET /dir/\n")
+	}
+	{
+		resp := testRequest(r, http.MethodGet, "/full", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusMovedPermanently)
+		assertHeader(t, resp.Header, "Location", "/full/")
+	}
+}
+
+func TestRouter_Server(t *testing.T) {
+	r := New()
+	r.Get("/").HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "OK")
+	})
+
+	srv := r.Server("127.0.0.1:0")
+	if srv.Addr != "127.0.0.1:0" || srv.Handler != r {
+		t.Errorf("unexpected server: %+v", srv)
+	}
+	if srv.ReadHeaderTimeout != DefaultReadHeaderTimeout || srv.IdleTimeout != DefaultIdleTimeout {
+		t.Errorf("unexpected timeouts: %s, %s", srv.ReadHeaderTimeout, srv.IdleTimeout)
+	}
+
+	ln, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		t.Skip(err)
+	}
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	resp, err := http.Get("http://" + ln.Addr().String() + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	assertStatus(t, resp.StatusCode, http.StatusOK)
+	assertBody(t, resp.Body, "OK")
+}
+
+func TestRouter_serveGraceful(t *testing.T) {
+	r := New()
+
+	started := make(chan struct{})
+	r.Get("/slow").HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(50 * time.Millisecond)
+		fmt.Fprint(w, "done")
+	})
+
+	var hooks []string
+	r.OnShutdown(func() {
+		hooks = append(hooks, "a")
+	})
+	r.Group(func(r *Router) {
+		r.OnShutdown(func() {
+			hooks = append(hooks, "b")
+		})
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+
+	srv := r.Server(ln.Addr().String())
+	stop := make(chan os.Signal, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- r.serveGraceful(srv, func() error { return srv.Serve(ln) }, stop, time.Second)
+	}()
+
+	respc := make(chan *http.Response, 1)
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String() + "/slow")
+		if err != nil {
+			t.Error(err)
+		}
+		respc <- resp
+	}()
+
+	<-started
+	stop <- os.Interrupt
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(hooks) != "[a b]" {
+		t.Errorf("unexpected hooks: %v", hooks)
+	}
+
+	resp := <-respc
+	if resp != nil {
+		defer resp.Body.Close()
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+		assertBody(t, resp.Body, "done")
+	}
+}
+
+func TestRouter_Health(t *testing.T) {
+	r := New()
+
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+		})
+	})
+
+	var checkErr error
+	r.Health("/health", func() error {
+		return checkErr
+	})
+	r.Health("/live", nil)
+
+	{
+		resp := testRequest(r, http.MethodGet, "/health", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+		assertHeader(t, resp.Header, "Content-Type", "application/json; charset=utf-8")
+		assertBody(t, resp.Body, `{"status":"ok"}`+"\n")
+	}
+
+	checkErr = errors.New("database is down")
+
+	{
+		resp := testRequest(r, http.MethodGet, "/health", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusServiceUnavailable)
+		assertBody(t, resp.Body, `{"status":"unavailable","error":"database is down"}`+"\n")
+	}
+	{
+		resp := testRequest(r, http.MethodGet, "/live", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+	}
+}
+
+func TestRouter_MaxPathLength(t *testing.T) {
+	r := New()
+
+	r.UseGlobal(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Test", "OK")
+			next.ServeHTTP(w, r)
+		})
+	})
+	r.Get("/{path...}").HandleFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	r.MaxPathLength(10)
+
+	a := []struct {
+		path   string
+		status int
+	}{
+		{"/123456789", http.StatusOK},
+		{"/1234567890", http.StatusRequestURITooLong},
+		{"/123456%20", http.StatusOK},
+		{"/1234567%20", http.StatusRequestURITooLong},
+	}
+	for _, v := range a {
+		resp := testRequest(r, http.MethodGet, v.path, nil, nil)
+		assertStatus(t, resp.StatusCode, v.status)
+		if v.status != http.StatusOK {
+			assertHeaderMissing(t, resp.Header, "X-Test")
+		}
+	}
+
+	r.MaxPathLength(0)
+
+	resp := testRequest(r, http.MethodGet, "/1234567890", nil, nil)
+	assertStatus(t, resp.StatusCode, http.StatusOK)
+}
+
+func TestTap(t *testing.T) {
+	var calls []string
+	sink := func(s string) {
+		calls = append(calls, s)
+	}
+
+	r := New()
+
+	r.UseGlobal(Tap("global", sink))
+	r.Use(Tap("router", sink))
+
+	r.Prefix("/api", func(r *Router) {
+		r.Use(Tap("group", sink))
+
+		r.Group(func(r *Router) {
+			r.Use(Tap("nested", sink))
+
+			h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				sink("handler")
+			})
+			r.Get("/test").Handle(Tap("route", sink)(h))
+		})
+	})
+
+	testRequest(r, http.MethodGet, "/api/test", nil, nil)
+
+	expected := []string{
+		"enter global", "enter router", "enter group", "enter nested", "enter route",
+		"handler",
+		"exit route", "exit nested", "exit group", "exit router", "exit global",
+	}
+	if fmt.Sprint(calls) != fmt.Sprint(expected) {
+		t.Errorf("\ngot:      %v\nexpected: %v", calls, expected)
+	}
+
+	calls = nil
+	testRequest(r, http.MethodGet, "/missing", nil, nil)
+
+	expected = []string{"enter global", "exit global"}
+	if fmt.Sprint(calls) != fmt.Sprint(expected) {
+		t.Errorf("\ngot:      %v\nexpected: %v", calls, expected)
+	}
+}
+
+func TestRouter_SetTimeout(t *testing.T) {
+	r := New()
+
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Test", "OK")
+			next.ServeHTTP(w, r)
+		})
+	})
+
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		fmt.Fprint(w, "slow")
+	})
+
+	r.Get("/fast").HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "fast")
+	})
+	r.Get("/slow").Handle(slow)
+	r.Get("/stream/{id}").Handle(slow).Where("id", regexp.MustCompile(`^\d+$`)).SkipMiddleware()
+	r.Get("/stream/{name}").Handle(slow)
+
+	r.SetTimeout(10 * time.Millisecond)
+
+	{
+		resp := testRequest(r, http.MethodGet, "/fast", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+		assertHeader(t, resp.Header, "X-Test", "OK")
+		assertBody(t, resp.Body, "fast")
+	}
+	{
+		resp := testRequest(r, http.MethodGet, "/slow", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusServiceUnavailable)
+	}
+	{
+		resp := testRequest(r, http.MethodGet, "/stream/111", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+		assertHeaderMissing(t, resp.Header, "X-Test")
+		assertBody(t, resp.Body, "slow")
+	}
+	{
+		resp := testRequest(r, http.MethodGet, "/stream/abc", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusServiceUnavailable)
+	}
+
+	r.SetTimeout(0)
+
+	{
+		resp := testRequest(r, http.MethodGet, "/slow", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+		assertHeader(t, resp.Header, "X-Test", "OK")
+	}
+}
+
+func TestRouter_Static(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "docs"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{
+		"video.txt":       "0123456789",
+		"docs/index.html": "<h1>docs</h1>",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := New()
+	r.Static("/static", dir)
+	r.Get("/static/info").HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "info")
+	})
+
+	{
+		resp := testRequest(r, http.MethodGet, "/static/video.txt", map[string]string{"Range": "bytes=2-5"}, nil)
+		assertStatus(t, resp.StatusCode, http.StatusPartialContent)
+		assertHeader(t, resp.Header, "Content-Range", "bytes 2-5/10")
+		assertHeader(t, resp.Header, "Accept-Ranges", "bytes")
+		assertBody(t, resp.Body, "2345")
+	}
+	{
+		resp := testRequest(r, http.MethodGet, "/static/video.txt", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+		assertHeader(t, resp.Header, "Content-Type", "text/plain; charset=utf-8")
+
+		modified := resp.Header.Get("Last-Modified")
+		resp = testRequest(r, http.MethodGet, "/static/video.txt", map[string]string{"If-Modified-Since": modified}, nil)
+		assertStatus(t, resp.StatusCode, http.StatusNotModified)
+	}
+	{
+		resp := testRequest(r, http.MethodGet, "/static/docs/", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+		assertBody(t, resp.Body, "<h1>docs</h1>")
+	}
+	{
+		resp := testRequest(r, http.MethodGet, "/static/info", nil, nil)
+		assertBody(t, resp.Body, "info")
+	}
+	for _, path := range []string{"/static/missing.txt", "/static/../router.go", "/static/"} {
+		resp := testRequest(r, http.MethodGet, path, nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusNotFound)
+	}
+}
+
+func TestRouter_OnTrailingSlashRedirect(t *testing.T) {
+	r := New()
+
+	var redirects []string
+	r.OnTrailingSlashRedirect(func(from, to string) {
+		redirects = append(redirects, from+" -> "+to)
+	})
+	r.Get("/aaa").HandleFunc(func(w http.ResponseWriter, r *http.Request) {})
+	r.Post("/bbb/").HandleFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	{
+		resp := testRequest(r, http.MethodGet, "/aaa/?x=1", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusMovedPermanently)
+		assertHeader(t, resp.Header, "Location", "/aaa?x=1")
+	}
+	{
+		resp := testRequest(r, http.MethodPost, "/bbb", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusTemporaryRedirect)
+		assertHeader(t, resp.Header, "Location", "/bbb/")
+	}
+	for _, path := range []string{"/aaa", "/ccc/"} {
+		testRequest(r, http.MethodGet, path, nil, nil)
+	}
+
+	if s := fmt.Sprint(redirects); s != "[/aaa/?x=1 -> /aaa?x=1 /bbb -> /bbb/]" {
+		t.Errorf("unexpected redirects: %s", s)
+	}
+
+	r.OnTrailingSlashRedirect(nil)
+	{
+		resp := testRequest(r, http.MethodGet, "/aaa/", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusMovedPermanently)
+	}
+	if len(redirects) != 2 {
+		t.Errorf("the callback has not been removed")
+	}
+}
+
+func TestRouter_Version(t *testing.T) {
+	r := New()
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("no panic without a media type")
+			}
+		}()
+		r.Version("0", func(r *Router) {})
+	}()
+
+	r.VersionMediaType("application/vnd.myapp.v%s+json")
+	for _, v := range []string{"1", "2"} {
+		v := v
+		r.Version(v, func(r *Router) {
+			r.Get("/users/{id}").Name("users.get.v" + v).HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, "v"+v+" ", ParamsFromRequest(r).ByName("id"))
+			})
+		})
+	}
+	r.Get("/users/{id}").HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "unversioned")
+	})
+
+	tests := []struct {
+		path   string
+		accept string
+		body   string
+	}{
+		{"/v1/users/1", "", "v1 1"},
+		{"/v2/users/1", "", "v2 1"},
+		{"/v1/users/1", "application/vnd.myapp.v2+json", "v1 1"},
+		{"/users/1", "application/vnd.myapp.v1+json", "v1 1"},
+		{"/users/1", "text/html, application/vnd.myapp.v2+json;q=0.9", "v2 1"},
+		{"/users/1", "application/vnd.myapp.v2+json;q=0", "unversioned"},
+		{"/users/1", "*/*", "unversioned"},
+		{"/users/1", "", "unversioned"},
+	}
+	for _, test := range tests {
+		resp := testRequest(r, http.MethodGet, test.path, map[string]string{"Accept": test.accept}, nil)
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+		assertBody(t, resp.Body, test.body)
+	}
+
+	{
+		u, err := r.Url("users.get.v1", 1)
+		assertError(t, err, nil)
+		if u != "/v1/users/1" {
+			t.Errorf("unexpected url: %s", u)
+		}
+	}
+	assertError(t, r.Validate(), nil)
+
+	r.VersionMediaType("application/vnd.example.v%s+json")
+	r.Version("3", func(r *Router) {
+		r.Get("/items").HandleFunc(func(w http.ResponseWriter, r *http.Request) {})
+	})
+	{
+		resp := testRequest(r, http.MethodGet, "/items", map[string]string{"Accept": "application/vnd.example.v3+json"}, nil)
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+	}
+	{
+		resp := testRequest(r, http.MethodGet, "/items", map[string]string{"Accept": "application/vnd.myapp.v3+json"}, nil)
+		assertStatus(t, resp.StatusCode, http.StatusNotFound)
+	}
+}
+
+func TestRouter_Version_nested(t *testing.T) {
+	r := New()
+	r.VersionMediaType("application/vnd.test.v%s+json")
+
+	subs := map[string]*Router{}
+	r.Version("1", func(r *Router) {
+		r.Version("2", func(r *Router) {
+			r.Version("3", func(r *Router) {
+				for _, v := range []string{"a", "b"} {
+					v := v
+					r.Version(v, func(r *Router) {
+						subs[v] = r
+					})
+				}
+			})
+		})
+	})
+
+	for _, v := range []string{"a", "b"} {
+		v := v
+		subs[v].Get("/test").HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, v)
+		})
+	}
+
+	for _, v := range []string{"a", "b"} {
+		accept := "application/vnd.test.v1+json, application/vnd.test.v2+json, " +
+			"application/vnd.test.v3+json, application/vnd.test.v" + v + "+json"
+		resp := testRequest(r, http.MethodGet, "/test", map[string]string{"Accept": accept}, nil)
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+		assertBody(t, resp.Body, v)
+	}
+}
+
+type testNotFoundError struct {
+	id string
+}
+
+func (e *testNotFoundError) Error() string {
+	return "not found: " + e.id
+}
+
+func TestRoute_HandleE(t *testing.T) {
+	r := New()
+
+	r.Get("/users/{id}").HandleE(func(w http.ResponseWriter, r *http.Request) error {
+		id := ParamsFromRequest(r).ByName("id")
+		switch id {
+		case "1":
+			fmt.Fprint(w, "user")
+			return nil
+		case "2":
+			return errors.New("database is down")
+		}
+		return fmt.Errorf("user: %w", &testNotFoundError{id: id})
+	})
+
+	{
+		resp := testRequest(r, http.MethodGet, "/users/3", nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusInternalServerError)
+		assertBody(t, resp.Body, http.StatusText(http.StatusInternalServerError)+"\n")
+	}
+
+	r.SetErrorRenderer(func(w http.ResponseWriter, r *http.Request, err error) {
+		var e *testNotFoundError
+		if errors.As(err, &e) {
+			http.Error(w, e.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, "oops", http.StatusInternalServerError)
+	})
+
+	tests := []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{"/users/1", http.StatusOK, "user"},
+		{"/users/2", http.StatusInternalServerError, "oops\n"},
+		{"/users/3", http.StatusNotFound, "not found: 3\n"},
+	}
+	for _, test := range tests {
+		resp := testRequest(r, http.MethodGet, test.path, nil, nil)
+		assertStatus(t, resp.StatusCode, test.status)
+		assertBody(t, resp.Body, test.body)
+	}
+}
+
+func TestRouter_MapError(t *testing.T) {
+	errNotFound := errors.New("not found")
+	errUnauthorized := errors.New("unauthorized")
+	errExpired := fmt.Errorf("token expired: %w", errUnauthorized)
+
+	r := New()
+	r.MapError(errExpired, http.StatusForbidden)
+	r.MapError(errUnauthorized, http.StatusUnauthorized)
+	r.MapError(errNotFound, http.StatusGone)
+	r.MapError(errNotFound, http.StatusNotFound)
+
+	errs := map[string]error{
+		"1": fmt.Errorf("user 1: %w", errNotFound),
+		"2": fmt.Errorf("session: %w", errUnauthorized),
+		"3": fmt.Errorf("session: %w", errExpired),
+		"4": errors.New("database is down"),
+		"5": fmt.Errorf("user 5: %w", &StatusError{Status: http.StatusConflict}),
+		"6": &StatusError{Status: http.StatusBadRequest, Err: errNotFound},
+	}
+	r.Get("/users/{id}").HandleE(func(w http.ResponseWriter, r *http.Request) error {
+		return errs[ParamsFromRequest(r).ByName("id")]
+	})
+
+	tests := []struct {
+		id     string
+		status int
+	}{
+		{"1", http.StatusNotFound},
+		{"2", http.StatusUnauthorized},
+		{"3", http.StatusForbidden},
+		{"4", http.StatusInternalServerError},
+		{"5", http.StatusConflict},
+		{"6", http.StatusNotFound},
+	}
+	for _, test := range tests {
+		resp := testRequest(r, http.MethodGet, "/users/"+test.id, nil, nil)
+		assertStatus(t, resp.StatusCode, test.status)
+		assertBody(t, resp.Body, http.StatusText(test.status)+"\n")
+
+		if status := r.ErrorStatus(errs[test.id]); status != test.status {
+			t.Errorf("unexpected status: %d", status)
+		}
+	}
+}
+
+func TestMatchedWildcard(t *testing.T) {
+	r := New()
+
+	var matched []bool
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r)
+			matched = append(matched, MatchedWildcard(r))
+		})
+	})
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, MatchedWildcard(r))
+	}
+	r.Get("/files/{path...}").HandleFunc(handler)
+	r.Get("/files/index").HandleFunc(handler)
+	r.Get("/docs/{name}.{format}").HandleFunc(handler)
+
+	tests := []struct {
+		path string
+		body string
+	}{
+		{"/files/a/b", "true"},
+		{"/files/index", "false"},
+		{"/docs/a.html", "false"},
+	}
+	for _, test := range tests {
+		resp := testRequest(r, http.MethodGet, test.path, nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+		assertBody(t, resp.Body, test.body)
+	}
+
+	if s := fmt.Sprint(matched); s != "[true false false]" {
+		t.Errorf("unexpected flags in middleware: %s", s)
+	}
+}
+
+func TestNearMissesFromRequest(t *testing.T) {
+	r := New()
+
+	r.HandleNotFound(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		misses := NearMissesFromRequest(r)
+		if len(misses) == 0 {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		for _, miss := range misses {
+			if miss.Param == "" {
+				fmt.Fprintf(w, "%s: request rejected %v\n", miss.Route.Pattern(), miss.Params)
+				continue
+			}
+			fmt.Fprintf(w, "%s: %s=%q must match %s\n", miss.Route.Pattern(), miss.Param, miss.Value, miss.Pattern)
+		}
+	}))
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if misses := NearMissesFromRequest(r); misses != nil {
+			t.Errorf("unexpected near misses: %v", misses)
+		}
+	}
+	r.Get("/users/{id}/posts/{post}").
+		Where("id", regexp.MustCompile(`^\d+$`)).
+		Where("post", regexp.MustCompile(`^\d+$`)).
+		HandleFunc(handler)
+	r.Get("/users/{name}/posts/{post}").
+		WhereHeader("X-Admin", `^1$`).
+		HandleFunc(handler)
+
+	tests := []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{"/users/1/posts/2", http.StatusOK, ""},
+		{"/users/1/posts/b", http.StatusUnprocessableEntity, "" +
+			`/users/{id}/posts/{post}: post="b" must match ^\d+$` + "\n" +
+			"/users/{name}/posts/{post}: request rejected [{name 1} {post b}]\n"},
+		{"/users/a/posts/b", http.StatusUnprocessableEntity, "" +
+			`/users/{id}/posts/{post}: id="a" must match ^\d+$` + "\n" +
+			"/users/{name}/posts/{post}: request rejected [{name a} {post b}]\n"},
+		{"/users/a", http.StatusNotFound, "404 page not found\n"},
+	}
+	for _, test := range tests {
+		resp := testRequest(r, http.MethodGet, test.path, nil, nil)
+		assertStatus(t, resp.StatusCode, test.status)
+		assertBody(t, resp.Body, test.body)
+	}
+	{
+		resp := testRequest(r, http.MethodGet, "/users/a/posts/b", map[string]string{"X-Admin": "1"}, nil)
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+	}
+}
+
+func TestRoute_Default(t *testing.T) {
+	r := New()
+
+	route := r.Get("/posts/{page...}").
+		Name("posts").
+		Where("page", regexp.MustCompile(`^\d*$`)).
+		Default("page", "1").
+		HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, "page ", ParamsFromRequest(r).ByName("page"))
+		})
+
+	tests := []struct {
+		path string
+		body string
+	}{
+		{"/posts/", "page 1"},
+		{"/posts/2", "page 2"},
+	}
+	for _, test := range tests {
+		resp := testRequest(r, http.MethodGet, test.path, nil, nil)
+		assertStatus(t, resp.StatusCode, http.StatusOK)
+		assertBody(t, resp.Body, test.body)
+	}
+
+	for value, expected := range map[interface{}]string{1: "/posts/", "": "/posts/", 2: "/posts/2"} {
+		u, err := r.Url("posts", value)
+		assertError(t, err, nil)
+		if u != expected {
+			t.Errorf("unexpected url: %s != %s", u, expected)
+		}
+	}
+
+	if params, ok := route.ParseUrl("/posts/"); !ok || params.ByName("page") != "1" {
+		t.Errorf("unexpected params: %v", params)
+	}
+
+	panics := []struct {
+		route *Route
+		param string
+		panic string
+	}{
+		{route, "id", "unknown parameter: id"},
+		{r.Get("/users/{id}"), "id", "not a catch-all parameter: id"},
+	}
+	for _, test := range panics {
+		func() {
+			defer func() {
+				if rcv := recover(); rcv != test.panic {
+					t.Errorf("unexpected panic: %v", rcv)
+				}
+			}()
+			test.route.Default(test.param, "1")
+		}()
+	}
+}
+
+func TestRouter_AllowedMethods_lookup(t *testing.T) {
+	r := New()
+
+	h := func(w http.ResponseWriter, r *http.Request) {}
+	r.Get("/users/new").Name("users.new").HandleFunc(h)
+	r.Post("/users/{id}").Name("users.update").HandleFunc(h)
+	r.Put("/{section}/new").Name("section.new").HandleFunc(h)
+
+	tests := []struct {
+		path    string
+		methods string
+	}{
+		{"/users/new", "[GET POST PUT]"},
+		{"/users/1", "[POST]"},
+		{"/posts/new", "[PUT]"},
+		{"/posts/1", "[]"},
+	}
+	for _, test := range tests {
+		if methods := fmt.Sprint(r.AllowedMethods(test.path)); methods != test.methods {
+			t.Errorf("%s: %s != %s", test.path, methods, test.methods)
+		}
+	}
+
+	for path, name := range map[string]string{"/users/new": "users.new", "/users/1": "", "/posts/new": ""} {
+		if result := r.DryRun(http.MethodGet, path, nil); result.Name != name {
+			t.Errorf("%s: %q != %q", path, result.Name, name)
+		}
+	}
+}
+
+func TestNearMissesFromRequest_allocs(t *testing.T) {
+	h := func(w http.ResponseWriter, r *http.Request) {}
+
+	exact := New()
+	exact.Get("/users/{name}").HandleFunc(h)
+
+	sibling := New()
+	sibling.Get("/users/{id}").Where("id", regexp.MustCompile(`^\d+$`)).HandleFunc(h)
+	sibling.Get("/users/{name}").HandleFunc(h)
+
+	allocs := func(r *Router) float64 {
+		base := httptest.NewRequest(http.MethodGet, "/users/abc", nil)
+		req := new(http.Request)
+		w := httptest.NewRecorder()
+		return testing.AllocsPerRun(100, func() {
+			*req = *base
+			r.ServeHTTP(w, req)
+		})
+	}
+
+	// The failed sibling is only described if no route matches.
+	if a, b := allocs(exact), allocs(sibling); a != b {
+		t.Errorf("allocations: %v != %v", b, a)
+	}
+}
+
+func TestRouter_DryRun(t *testing.T) {
+	r := New()
+	r.UseGlobal(Tap("global", func(string) {}))
+	r.Use(Tap("use", func(string) {}))
+	r.MaxPathLength(64)
+	r.AutoHead(true)
+
+	called := false
+	h := func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}
+
+	r.Get("/users/{id}").
+		Name("users.v2").
+		WhereHeader("Accept", `version=2`).
+		Transform("id", strings.ToLower).
+		HandleFunc(h)
+	r.Get("/users/{id}").Name("users.get").Where("id", regexp.MustCompile(`^\w+$`)).HandleFunc(h)
+	r.Get("/search").Name("search.images").WhereQuery("type", `^image$`).HandleFunc(h)
+	r.Get("/search").Name("search").HandleFunc(h)
+	r.Post("/upload").Consumes("image/png").HandleFunc(h)
+	r.Get("/files/{path...}").Name("files").HandleFunc(h)
+	r.Get("/files/index").Name("files.index").HandleFunc(h)
+	r.Get("/docs/").HandleFunc(h)
+
+	a := []struct {
+		method  string
+		path    string
+		headers http.Header
+		name    string
+		params  string
+		status  int
+	}{
+		{http.MethodGet, "/users/ABC", nil, "users.get", "[{id ABC}]", http.StatusOK},
+		{http.MethodGet, "/users/ABC", http.Header{"Accept": {"application/json; version=2"}}, "users.v2", "[{id abc}]", http.StatusOK},
+		{http.MethodHead, "/users/ABC", nil, "users.get", "[{id ABC}]", http.StatusOK},
+		{http.MethodGet, "/users/a-b", nil, "", "[]", http.StatusNotFound},
+		{http.MethodGet, "/search?type=image", nil, "search.images", "[]", http.StatusOK},
+		{http.MethodGet, "/search?type=video", nil, "search", "[]", http.StatusOK},
+		{http.MethodGet, "/files/a/b", nil, "files", "[{path a/b}]", http.StatusOK},
+		{http.MethodGet, "/files/index", nil, "files.index", "[]", http.StatusOK},
+		{http.MethodPost, "/upload", http.Header{"Content-Type": {"image/png"}}, "", "[]", http.StatusOK},
+		{http.MethodPost, "/upload", nil, "", "[]", 0},
+		{http.MethodPost, "/search", nil, "", "[]", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/docs", nil, "", "[]", http.StatusMovedPermanently},
+		{http.MethodGet, "/missing", nil, "", "[]", http.StatusNotFound},
+		{http.MethodGet, "/" + strings.Repeat("a", 64), nil, "", "[]", http.StatusRequestURITooLong},
+	}
+	for _, v := range a {
+		result := r.DryRun(v.method, v.path, v.headers)
+		if result.Status != v.status || result.Name != v.name || fmt.Sprint(result.Params) != v.params {
+			t.Errorf("%s %s: unexpected result: %+v", v.method, v.path, result)
+		}
+		if result.GlobalMiddleware != 1 {
+			t.Errorf("%s %s: global middleware: %d != %d", v.method, v.path, result.GlobalMiddleware, 1)
+		}
+		if (result.Route != nil) != (result.Middleware == 1) {
+			t.Errorf("%s %s: middleware: %d", v.method, v.path, result.Middleware)
+		}
+		if (v.status == 0) != result.Rejected {
+			t.Errorf("%s %s: rejected: %v", v.method, v.path, result.Rejected)
+		}
+	}
+
+	if result := r.DryRun(http.MethodGet, "/docs?a=1", nil); result.Location != "/docs/?a=1" {
+		t.Errorf("unexpected location: %s", result.Location)
+	}
+	if result := r.DryRun(http.MethodGet, "/users/1", nil); result.Pattern != "/users/{id}" || result.Route == nil {
+		t.Errorf("unexpected result: %+v", result)
+	}
+	if called {
+		t.Error("a handler has been called")
+	}
+}
+
+func TestServeWithContext(t *testing.T) {
+	r := New()
+	r.SetTimeout(time.Hour)
+
+	release := make(chan struct{})
+	defer close(release)
+
+	r.Get("/block").HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	})
+	r.Get("/deadline").SkipMiddleware().HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		http.Error(w, r.Context().Err().Error(), http.StatusGatewayTimeout)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	resp := routertest.ServeWithContext(r, ctx, http.MethodGet, "/block", nil)
+	assertStatus(t, resp.StatusCode, http.StatusServiceUnavailable)
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+
+	resp = routertest.ServeWithContext(r, ctx, http.MethodGet, "/deadline", nil)
+	assertStatus(t, resp.StatusCode, http.StatusGatewayTimeout)
+	assertBody(t, resp.Body, context.DeadlineExceeded.Error()+"\n")
 }
 
 func testRequest(
@@ -0,0 +1,26 @@
+// Package routertest provides utilities for testing handlers and middleware of the router.
+package routertest
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+)
+
+// ServeWithContext serves a request with the context by the handler, and returns the recorded response.
+// The context can be canceled or have a deadline, so that the handling of cancellation
+// and timeouts can be tested deterministically, without waiting for a real timeout.
+//
+// The timeout set with Router.SetTimeout is applied to the context of the request,
+// so an earlier deadline of ctx takes precedence over it. If ctx is already done
+// when the handler is still running, the router responds with 503 Service Unavailable immediately,
+// as if the timeout has been exceeded; a handler that finishes first may still write its own response.
+// Routes with SkipMiddleware get ctx as is.
+func ServeWithContext(handler http.Handler, ctx context.Context, method string, target string, body io.Reader) *http.Response {
+	r := httptest.NewRequest(method, target, body).WithContext(ctx)
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, r)
+	return w.Result()
+}
@@ -0,0 +1,61 @@
+package router
+
+import (
+	"net/http"
+)
+
+// SecurityOptions configures the middleware returned by SecurityHeaders.
+// An empty value selects the default value of the header, and the value "-" omits the header.
+type SecurityOptions struct {
+	// ContentTypeOptions is the value of the X-Content-Type-Options header, "nosniff" by default.
+	ContentTypeOptions string
+
+	// FrameOptions is the value of the X-Frame-Options header, "DENY" by default.
+	FrameOptions string
+
+	// StrictTransportSecurity is the value of the Strict-Transport-Security header,
+	// "max-age=31536000; includeSubDomains" by default.
+	StrictTransportSecurity string
+
+	// ContentSecurityPolicy is the value of the Content-Security-Policy header, "default-src 'self'" by default.
+	ContentSecurityPolicy string
+
+	// ReferrerPolicy is the value of the Referrer-Policy header, "strict-origin-when-cross-origin" by default.
+	ReferrerPolicy string
+}
+
+// SecurityHeaders returns a middleware function that sets common security headers on responses.
+// The headers are set before the next handler is called, and only if they have not been set yet,
+// so the values set by handlers or by outer middleware functions take precedence.
+// The middleware function can be added with UseGlobal to cover all responses, including errors.
+func SecurityHeaders(opts SecurityOptions) MiddlewareFunc {
+	headers := make([][2]string, 0, 5)
+	add := func(name string, value string, defaultValue string) {
+		switch value {
+		case "-":
+			return
+		case "":
+			value = defaultValue
+		}
+		headers = append(headers, [2]string{name, value})
+	}
+
+	add("X-Content-Type-Options", opts.ContentTypeOptions, "nosniff")
+	add("X-Frame-Options", opts.FrameOptions, "DENY")
+	add("Strict-Transport-Security", opts.StrictTransportSecurity, "max-age=31536000; includeSubDomains")
+	add("Content-Security-Policy", opts.ContentSecurityPolicy, "default-src 'self'")
+	add("Referrer-Policy", opts.ReferrerPolicy, "strict-origin-when-cross-origin")
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h := w.Header()
+			for _, header := range headers {
+				if h.Get(header[0]) == "" {
+					h.Set(header[0], header[1])
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package router
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+const (
+	// DefaultReadHeaderTimeout is the ReadHeaderTimeout of the servers created by Router.Server.
+	DefaultReadHeaderTimeout = 10 * time.Second
+
+	// DefaultIdleTimeout is the IdleTimeout of the servers created by Router.Server.
+	DefaultIdleTimeout = 120 * time.Second
+)
+
+// Server creates an HTTP server listening on the address and handling requests with the router.
+// Unlike a zero http.Server, it limits the time to read the request headers
+// to DefaultReadHeaderTimeout, and the time to wait for the next request on a keep-alive
+// connection to DefaultIdleTimeout, so that idle or slow clients cannot hold connections forever.
+// The time to read the body and to write the response is not limited, since it depends
+// on the handlers; use SetTimeout or adjust the returned server if needed.
+func (router *Router) Server(addr string) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           router,
+		ReadHeaderTimeout: DefaultReadHeaderTimeout,
+		IdleTimeout:       DefaultIdleTimeout,
+	}
+}
+
+// ListenAndServe listens on the address and handles requests with the router,
+// using a server created by Server.
+func (router *Router) ListenAndServe(addr string) error {
+	return router.Server(addr).ListenAndServe()
+}
+
+// ListenAndServeTLS listens on the address and handles HTTPS requests with the router,
+// using a server created by Server and the certificate and key files.
+func (router *Router) ListenAndServeTLS(addr string, certFile string, keyFile string) error {
+	return router.Server(addr).ListenAndServeTLS(certFile, keyFile)
+}
+
+// OnShutdown adds a function that is called by ListenAndServeGraceful after the server has been shut down,
+// e.g. to close database connections. The functions are called in the order they have been added.
+func (router *Router) OnShutdown(fn func()) {
+	router.global.shutdownHooks = append(router.global.shutdownHooks, fn)
+}
+
+// ListenAndServeGraceful listens on the address and handles requests with the router,
+// using a server created by Server, until the process receives SIGINT or SIGTERM.
+// The server is then shut down gracefully: it stops accepting new connections and waits
+// up to shutdownTimeout for the active requests to complete. After that, the functions
+// added with OnShutdown are called.
+//
+// It returns the error of http.Server.Shutdown, e.g. context.DeadlineExceeded if the requests
+// have not completed in time, or the error of listening if the server has failed to start.
+func (router *Router) ListenAndServeGraceful(addr string, shutdownTimeout time.Duration) error {
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(stop)
+
+	srv := router.Server(addr)
+	return router.serveGraceful(srv, srv.ListenAndServe, stop, shutdownTimeout)
+}
+
+func (router *Router) serveGraceful(
+	srv *http.Server, serve func() error, stop <-chan os.Signal, shutdownTimeout time.Duration,
+) error {
+	errc := make(chan error, 1)
+	go func() {
+		errc <- serve()
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-stop:
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	err := srv.Shutdown(ctx)
+
+	for _, fn := range router.global.shutdownHooks {
+		fn()
+	}
+
+	return err
+}
@@ -2,6 +2,8 @@ package router
 
 import (
 	"net/http"
+	"regexp"
+	"time"
 )
 
 var (
@@ -31,6 +33,11 @@ func Group(f func(*Router)) {
 	DefaultRouter().Group(f)
 }
 
+// When adds a group of routes only if enabled is true.
+func When(enabled bool, f func(*Router)) {
+	DefaultRouter().When(enabled, f)
+}
+
 // Prefix adds a group of routes with a specified prefix.
 // The prefix can contain named parameters.
 func Prefix(path string, f func(*Router)) {
@@ -42,6 +49,27 @@ func Use(middleware ...MiddlewareFunc) {
 	DefaultRouter().Use(middleware...)
 }
 
+// UseGlobal adds middleware functions that wrap the entire router.
+// They run for every request before routing, including unmatched requests.
+func UseGlobal(middleware ...MiddlewareFunc) {
+	DefaultRouter().UseGlobal(middleware...)
+}
+
+// SetTimeout sets a time limit for handling every request.
+func SetTimeout(d time.Duration) {
+	DefaultRouter().SetTimeout(d)
+}
+
+// MaxPathLength sets the maximum length of the escaped path of a request.
+func MaxPathLength(n int) {
+	DefaultRouter().MaxPathLength(n)
+}
+
+// Regexp returns a compiled regular expression from a cache shared by the default router and its groups.
+func Regexp(expr string) *regexp.Regexp {
+	return DefaultRouter().Regexp(expr)
+}
+
 // Get creates and returns a route for handling GET requests.
 func Get(path string) *Route {
 	return DefaultRouter().Get(path)
@@ -72,21 +100,76 @@ func Options(path string) *Route {
 	return DefaultRouter().Options(path)
 }
 
+// Except creates and returns a route for handling requests sent with any standard method
+// except the specified ones.
+func Except(path string, excluded ...string) *Route {
+	return DefaultRouter().Except(path, excluded...)
+}
+
+// Handle mounts a handler at the prefix, so that it handles all requests for the paths under the prefix.
+// If stripPrefix is true, the handler receives requests with the prefix removed from the path.
+func Handle(prefix string, handler http.Handler, stripPrefix bool) *Route {
+	return DefaultRouter().Handle(prefix, handler, stripPrefix)
+}
+
 // NewRoute creates and returns a route for handling requests sent with the specified methods.
 func NewRoute(path string, methods ...string) *Route {
 	return DefaultRouter().NewRoute(path, methods...)
 }
 
+// RemoveRoute removes the routes with the specified pattern for the method.
+// It reports whether any routes have been removed.
+func RemoveRoute(method string, path string) bool {
+	return DefaultRouter().RemoveRoute(method, path)
+}
+
+// StrictUrlParams sets whether Url returns ErrTooManyParameters when it gets more values
+// than the parameters of the route.
+func StrictUrlParams(strict bool) {
+	DefaultRouter().StrictUrlParams(strict)
+}
+
+// AutoHead sets whether HEAD requests are handled by the GET routes, if there is no HEAD route for the path.
+func AutoHead(enabled bool) {
+	DefaultRouter().AutoHead(enabled)
+}
+
 // Url generates a URL for a named route.
 func Url(name string, params ...interface{}) (string, error) {
 	return DefaultRouter().Url(name, params...)
 }
 
+// UrlForMethod generates a URL for a named route handling the method.
+func UrlForMethod(name string, method string, params ...interface{}) (string, error) {
+	return DefaultRouter().UrlForMethod(name, method, params...)
+}
+
+// GenerateUrls generates URLs for all named routes, using the sample values of parameters.
+func GenerateUrls(sample func(routeName string, paramName string) interface{}) (map[string]string, error) {
+	return DefaultRouter().GenerateUrls(sample)
+}
+
+// Urls generates the URLs of several named routes in one call.
+func Urls(requests []UrlRequest) ([]string, error) {
+	return DefaultRouter().Urls(requests)
+}
+
+// AllowedMethods returns a sorted list of methods of the routes matching the path.
+// The conditions of parameters are taken into account, the conditions of requests are not.
+func AllowedMethods(path string) []string {
+	return DefaultRouter().AllowedMethods(path)
+}
+
 // HandleNotFound sets a handler that is called when a route is not found.
 func HandleNotFound(handler http.Handler) {
 	DefaultRouter().HandleNotFound(handler)
 }
 
+// Fallback sets a handler that is called when no route matches the request.
+func Fallback(handler http.Handler) {
+	DefaultRouter().Fallback(handler)
+}
+
 // HandleMethodNotAllowed sets a handler that is called when the route is found,
 // but the request method is not supported.
 func HandleMethodNotAllowed(handler http.Handler) {
@@ -99,3 +182,30 @@ func HandleMethodNotAllowed(handler http.Handler) {
 func HandlePanic(handler func(http.ResponseWriter, *http.Request, interface{})) {
 	DefaultRouter().HandlePanic(handler)
 }
+
+// UsePanicHandler adds panic handlers to the router.
+// The handlers are called in the order they have been added.
+func UsePanicHandler(handlers ...func(http.ResponseWriter, *http.Request, interface{})) {
+	DefaultRouter().UsePanicHandler(handlers...)
+}
+
+// ListenAndServe listens on the address and handles requests with the default router.
+func ListenAndServe(addr string) error {
+	return DefaultRouter().ListenAndServe(addr)
+}
+
+// ListenAndServeTLS listens on the address and handles HTTPS requests with the default router.
+func ListenAndServeTLS(addr string, certFile string, keyFile string) error {
+	return DefaultRouter().ListenAndServeTLS(addr, certFile, keyFile)
+}
+
+// ListenAndServeGraceful listens on the address and handles requests with the default router
+// until the process receives SIGINT or SIGTERM, and then shuts the server down gracefully.
+func ListenAndServeGraceful(addr string, shutdownTimeout time.Duration) error {
+	return DefaultRouter().ListenAndServeGraceful(addr, shutdownTimeout)
+}
+
+// OnShutdown adds a function that is called by ListenAndServeGraceful after the server has been shut down.
+func OnShutdown(fn func()) {
+	DefaultRouter().OnShutdown(fn)
+}
@@ -0,0 +1,75 @@
+package router
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"path"
+)
+
+// Static adds a route serving the files of the directory under the prefix, e.g. "/assets".
+// See StaticFS.
+func (router *Router) Static(prefix string, dir string) *Route {
+	return router.StaticFS(prefix, http.Dir(dir))
+}
+
+// StaticFS adds a route serving the files of the file system under the prefix,
+// handling GET and HEAD requests. The path of a file is the catch-all parameter "path" of the route.
+//
+// The files are served with http.ServeContent, so Range requests are answered with 206 Partial Content,
+// conditional requests with If-Modified-Since and similar headers are supported,
+// and the Content-Type is detected from the extension or the content of a file.
+// A directory is served by its "index.html" file; directories are not listed.
+// Paths with ".." segments are rejected with NoTraversal.
+func (router *Router) StaticFS(prefix string, fsys http.FileSystem) *Route {
+	return router.NewRoute(path.Join("/", prefix, "{path...}"), http.MethodGet, http.MethodHead).
+		NoTraversal().
+		HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+			serveFile(w, r, fsys, "/"+ParamsFromRequest(r).ByName("path"))
+		})
+}
+
+func serveFile(w http.ResponseWriter, r *http.Request, fsys http.FileSystem, name string) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		serveFileError(w, err)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		serveFileError(w, err)
+		return
+	}
+
+	if info.IsDir() {
+		index := path.Join(name, "index.html")
+		f, err = fsys.Open(index)
+		if err != nil {
+			serveFileError(w, err)
+			return
+		}
+		defer f.Close()
+
+		info, err = f.Stat()
+		if err != nil || info.IsDir() {
+			http.NotFound(w, r)
+			return
+		}
+	}
+
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+}
+
+func serveFileError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		status = http.StatusNotFound
+	case errors.Is(err, fs.ErrPermission):
+		status = http.StatusForbidden
+	}
+
+	http.Error(w, http.StatusText(status), status)
+}
@@ -0,0 +1,88 @@
+package router
+
+import (
+	"github.com/olegshs/router/helpers"
+)
+
+// Tag adds tags to the routes subsequently created by the router or by a group of routes,
+// e.g. to list the routes of a section with RoutesByTag.
+func (router *Router) Tag(tags ...string) {
+	router.tags = appendTags(router.tags, tags)
+}
+
+// Tag adds tags to the route, in addition to the ones of the group it has been created in.
+// The tags are arbitrary strings, e.g. "admin", used for introspection and documentation.
+// The middleware functions added with Router.UseForTag for the new tags are applied to the route.
+func (route *Route) Tag(tags ...string) *Route {
+	for _, tag := range tags {
+		if !route.HasTag(tag) {
+			route.tags = appendTags(route.tags, []string{tag})
+			route.useForTag(tag)
+		}
+	}
+	return route
+}
+
+// UseForTag adds middleware functions to the routes having the tag, whenever they have been created or tagged,
+// e.g. to require a second factor of authentication for all "admin" routes, separately from their definitions.
+// The functions wrap the handler of a route inside the middleware added with Use,
+// and run even if the route skips middleware.
+// If several such functions apply to a route, they run in the order they have been applied to it.
+func (router *Router) UseForTag(tag string, middleware ...MiddlewareFunc) {
+	router.global.tagMiddleware = append(router.global.tagMiddleware, tagMiddleware{
+		tag:        tag,
+		middleware: middleware,
+	})
+
+	for _, route := range router.RoutesByTag(tag) {
+		route.use(middleware...)
+	}
+}
+
+// tagMiddleware holds the middleware functions added with UseForTag.
+type tagMiddleware struct {
+	tag        string
+	middleware middlewareList
+}
+
+// useForTag applies the middleware functions added with UseForTag for the tag to the route.
+func (route *Route) useForTag(tag string) {
+	for _, m := range route.router.global.tagMiddleware {
+		if m.tag == tag {
+			route.use(m.middleware...)
+		}
+	}
+}
+
+// Tags returns the tags of the route in the order they have been added.
+func (route *Route) Tags() []string {
+	return append([]string(nil), route.tags...)
+}
+
+// HasTag reports whether the route has the tag.
+func (route *Route) HasTag(tag string) bool {
+	return helpers.Slice[string](route.tags).IndexOf(tag) >= 0
+}
+
+// RoutesByTag returns the routes of the router having the tag, sorted as in Routes.
+func (router *Router) RoutesByTag(tag string) []*Route {
+	routes := make([]*Route, 0)
+	for _, route := range router.Routes() {
+		if route.HasTag(tag) {
+			routes = append(routes, route)
+		}
+	}
+	return routes
+}
+
+// appendTags returns a new slice with the tags added, skipping duplicates,
+// so that the slices of groups and routes are never shared.
+func appendTags(a []string, tags []string) []string {
+	result := append(make([]string, 0, len(a)+len(tags)), a...)
+	for _, tag := range tags {
+		if helpers.Slice[string](result).IndexOf(tag) < 0 {
+			result = append(result, tag)
+		}
+	}
+	return result
+}
@@ -0,0 +1,76 @@
+package router
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// OnTrailingSlashRedirect sets a function called when a request is redirected to the path
+// with or without a trailing slash, because only the other variant has a route.
+// It receives the requested URL and the target of the redirect,
+// which tells such redirects apart from the requests that are not found, e.g. to log or count them.
+// A nil function removes the callback.
+//
+// The callback runs before the redirect is written, inside the middleware added with UseGlobal.
+func (router *Router) OnTrailingSlashRedirect(fn func(from, to string)) {
+	router.global.onTrailingSlash = fn
+	router.buildGlobalHandler()
+}
+
+// trailingSlashHandler performs the redirects to the path with or without a trailing slash
+// instead of httprouter, so the redirect decision can be observed.
+func (router *Router) trailingSlashHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		location, code := router.trailingSlashRedirect(r.Method, r.URL)
+		if code == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if fn := router.global.onTrailingSlash; fn != nil {
+			fn(r.URL.String(), location)
+		}
+		http.Redirect(w, r, location, code)
+	})
+}
+
+// trailingSlashRedirect returns the target and the status code of the redirect httprouter makes
+// to the path with or without a trailing slash, or a zero code if the request is not redirected.
+func (router *Router) trailingSlashRedirect(method string, u *url.URL) (string, int) {
+	return router.global.trailingSlashRedirect(router.r, method, u)
+}
+
+// trailingSlashRedirect redirects the requests as httprouter does, also to the paths
+// matched by the routes with catch-all parameters moved out of it, e.g. from /api to /api/ for /api/{path...}.
+func (global *globalHandler) trailingSlashRedirect(r *httprouter.Router, method string, u *url.URL) (string, int) {
+	if !r.RedirectTrailingSlash || method == http.MethodConnect || u.Path == "/" {
+		return "", 0
+	}
+
+	handle, _, tsr := r.Lookup(method, u.Path)
+	if handle != nil {
+		return "", 0
+	}
+	if !tsr && (global.matchesWildcard(method, u.Path) || !global.matchesWildcard(method, toggleTrailingSlash(u.Path))) {
+		return "", 0
+	}
+
+	code := http.StatusMovedPermanently
+	if method != http.MethodGet {
+		code = http.StatusTemporaryRedirect
+	}
+
+	location := *u
+	location.Path = toggleTrailingSlash(location.Path)
+	return location.String(), code
+}
+
+// toggleTrailingSlash removes the trailing slash of the path, or adds one if there is none.
+func toggleTrailingSlash(path string) string {
+	if path[len(path)-1] == '/' {
+		return path[:len(path)-1]
+	}
+	return path + "/"
+}
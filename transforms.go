@@ -0,0 +1,34 @@
+package router
+
+// transforms holds the transformation functions of parameters indexed by the position of the parameter.
+type transforms []func(string) string
+
+func (t transforms) clone() transforms {
+	clone := make(transforms, len(t))
+	copy(clone, t)
+	return clone
+}
+
+// add adds a function for the parameter. Several functions are applied in the order they have been added.
+func (t *transforms) add(i int, fn func(string) string) {
+	for len(*t) <= i {
+		*t = append(*t, nil)
+	}
+
+	prev := (*t)[i]
+	if prev == nil {
+		(*t)[i] = fn
+		return
+	}
+
+	(*t)[i] = func(v string) string {
+		return fn(prev(v))
+	}
+}
+
+func (t transforms) apply(i int, v string) string {
+	if i < len(t) && t[i] != nil {
+		return t[i](v)
+	}
+	return v
+}
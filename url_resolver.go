@@ -0,0 +1,70 @@
+package router
+
+import (
+	"fmt"
+)
+
+// UrlResolver generates URLs for named routes of several routers,
+// e.g. in templates of a modular application where each module has its own router.
+// The names are looked up in the routers when Url is called,
+// so routes added to the routers later are also resolved.
+type UrlResolver struct {
+	routers []*Router
+}
+
+// NewUrlResolver creates a resolver for the named routes of the routers.
+// It returns an error wrapping ErrDuplicateName if several routers have routes with the same name.
+func NewUrlResolver(routers ...*Router) (*UrlResolver, error) {
+	resolver := new(UrlResolver)
+	for _, router := range routers {
+		if err := resolver.Add(router); err != nil {
+			return nil, err
+		}
+	}
+	return resolver, nil
+}
+
+// Add adds a router to the resolver.
+// It returns an error wrapping ErrDuplicateName, and does not add the router,
+// if the router has routes with the same names as the routers already added.
+func (resolver *UrlResolver) Add(router *Router) error {
+	for name := range router.routeByName {
+		if resolver.has(name) {
+			return fmt.Errorf("%s: %w", name, ErrDuplicateName)
+		}
+	}
+
+	resolver.routers = append(resolver.routers, router)
+	return nil
+}
+
+// Url generates a URL for a named route of any of the routers.
+// It returns an error wrapping ErrDuplicateName if the name is used by several routers,
+// which is possible if routes have been added to the routers after they were added to the resolver.
+func (resolver *UrlResolver) Url(name string, params ...interface{}) (string, error) {
+	var found *Router
+	for _, router := range resolver.routers {
+		if _, ok := router.routeByName[name]; !ok {
+			continue
+		}
+		if found != nil {
+			return "", fmt.Errorf("%s: %w", name, ErrDuplicateName)
+		}
+		found = router
+	}
+
+	if found == nil {
+		return "", fmt.Errorf("%s: %w", name, ErrRouteNotFound)
+	}
+
+	return found.Url(name, params...)
+}
+
+func (resolver *UrlResolver) has(name string) bool {
+	for _, router := range resolver.routers {
+		if _, ok := router.routeByName[name]; ok {
+			return true
+		}
+	}
+	return false
+}
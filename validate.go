@@ -0,0 +1,153 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/olegshs/router/helpers"
+)
+
+// ValidationError holds all problems found by Router.Validate, Router.GenerateUrls, Router.Urls or Router.ParseMapWith.
+type ValidationError struct {
+	Errors []error
+}
+
+// Error implements the error interface.
+func (e *ValidationError) Error() string {
+	a := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		a[i] = err.Error()
+	}
+	return strings.Join(a, "\n")
+}
+
+// Unwrap returns the problems found, so that errors.Is and errors.As can inspect them.
+func (e *ValidationError) Unwrap() []error {
+	return e.Errors
+}
+
+// Is reports whether any of the problems matches the target.
+func (e *ValidationError) Is(target error) bool {
+	for _, err := range e.Errors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks the routes of the router, so that configuration problems
+// can be detected at startup rather than via unexpected 404 responses at runtime.
+// The following problems are reported:
+//   - routes without handlers (ErrNoHandler);
+//   - names given to several routes with different patterns, only the last of which is used by Url (ErrDuplicateName);
+//   - routes that can never match, because an earlier route with the same pattern
+//     and method has no conditions (ErrShadowedRoute);
+//   - parameters of named routes without conditions that an earlier route with the same pattern
+//     and method has, so some of the URLs generated by Url are served by the earlier route (ErrMissingCondition).
+//
+// If any problems are found, a *ValidationError is returned.
+func (router *Router) Validate() error {
+	var errs []error
+
+	routes := router.Routes()
+
+	names := make(map[string][]*Route)
+	for _, route := range routes {
+		if !route.HasHandler() {
+			errs = append(errs, fmt.Errorf("%s: %w", route, ErrNoHandler))
+		}
+		if route.name != "" {
+			names[route.name] = append(names[route.name], route)
+		}
+	}
+
+	for _, name := range helpers.Map[string, []*Route](names).SortedKeys() {
+		if a := names[name]; len(a) > 1 && !samePattern(a) {
+			s := make([]string, len(a))
+			for i, route := range a {
+				s[i] = route.String()
+			}
+			errs = append(errs, fmt.Errorf("%s: %w (%s)", name, ErrDuplicateName, strings.Join(s, "; ")))
+		}
+	}
+
+	shadowed := make(map[*Route]*Route)
+	for _, m := range router.routes {
+		for _, a := range m {
+			var first *Route
+			for _, route := range *a {
+				if first != nil {
+					if _, ok := shadowed[route]; !ok {
+						shadowed[route] = first
+					}
+					continue
+				}
+				if route.HasHandler() && !route.HasConditions() {
+					first = route
+				}
+			}
+		}
+	}
+	for _, route := range routes {
+		if by, ok := shadowed[route]; ok {
+			errs = append(errs, fmt.Errorf("%s: %w by %s", route, ErrShadowedRoute, by))
+		}
+	}
+
+	for _, route := range routes {
+		if route.name == "" || !route.HasHandler() || route.splitters != nil {
+			continue
+		}
+		errs = append(errs, route.missingConditions()...)
+	}
+
+	if len(errs) > 0 {
+		return &ValidationError{Errors: errs}
+	}
+	return nil
+}
+
+// missingConditions reports the parameters of the route without conditions,
+// which are set for the same parameters of earlier routes with the same pattern and method.
+func (route *Route) missingConditions() []error {
+	var errs []error
+	reported := make(map[int]bool)
+
+	for _, method := range route.methods {
+		a, ok := route.router.routes[method][route.pattern.httpRouterString()]
+		if !ok {
+			continue
+		}
+
+		for _, earlier := range *a {
+			if earlier == route {
+				break
+			}
+			if !earlier.HasHandler() || earlier.splitters != nil {
+				continue
+			}
+
+			for i, name := range route.paramNames {
+				if reported[i] || route.conditions.get(i) != nil || earlier.conditions.get(i) == nil {
+					continue
+				}
+				reported[i] = true
+				errs = append(errs, fmt.Errorf("%s: %s: %w (matched by %s)", route, name, ErrMissingCondition, earlier))
+			}
+		}
+	}
+
+	return errs
+}
+
+// samePattern reports whether the routes have the same pattern, e.g. being one named route split by methods.
+func samePattern(routes []*Route) bool {
+	for _, route := range routes[1:] {
+		if route.pattern != routes[0].pattern {
+			return false
+		}
+	}
+	return true
+}
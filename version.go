@@ -0,0 +1,48 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// VersionMediaType sets the media type selecting a version of the routes added with Version,
+// e.g. "application/vnd.example.v%s+json", where the verb %s is replaced with the version.
+// It affects the groups added afterwards, so the groups can use different media types
+// if it is changed between them.
+func (router *Router) VersionMediaType(format string) {
+	router.global.versionMediaType = format
+}
+
+// Version adds a group of routes for a version of an API, which clients can select
+// either by the URL or by the Accept header.
+//
+// The routes are added twice: with the prefix "/v{v}", e.g. "/v1/users",
+// and without it, e.g. "/users", the latter matching only requests that accept
+// the media type of the version set with VersionMediaType, e.g. "application/vnd.example.v1+json".
+// It panics if no media type has been set.
+// So f is called twice, and must not depend on being called once.
+//
+// The URL takes precedence: a prefixed path selects its version whatever the Accept header is.
+// The paths without the prefix are routed by the header; if no version is accepted,
+// the next route with the same pattern is tried, e.g. an unversioned route added after the groups,
+// or the NotFound handler is called.
+// Names are given only to the prefixed routes, so Url generates the URLs of the prefixed paths:
+// Route.Name has no effect on the routes without the prefix, when f is called for them.
+func (router *Router) Version(v string, f func(*Router)) {
+	format := router.global.versionMediaType
+	if format == "" {
+		panic("no media type set with VersionMediaType")
+	}
+	mediaType := fmt.Sprintf(format, v)
+
+	router.Prefix("/v"+v, f)
+
+	sub := router.clone()
+	sub.unnamed = true
+	sub.requestConditions = append(sub.requestConditions.clone(), requestCondition{
+		match: func(r *http.Request) bool {
+			return acceptsMediaType(r.Header.Values("Accept"), mediaType)
+		},
+	})
+	f(sub)
+}
@@ -0,0 +1,257 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// wildcardHandler is the handler of routes with a catch-all parameter that cannot be registered
+// in httprouter, because other routes share the segment of the parameter, e.g. /api/{path...} and /api/users.
+// Such routes are matched when httprouter finds no route, so the other routes take precedence.
+type wildcardHandler struct {
+	method  string
+	pattern string
+	regexp  *regexp.Regexp
+	depth   int
+	routes  *routeList
+	handler http.Handler
+}
+
+type wildcardKeyType struct{}
+
+var wildcardKey = wildcardKeyType{}
+
+// register registers the handler of the routes in httprouter.
+//
+// If a pattern with a catch-all parameter conflicts with the routes registered before,
+// it is matched by the router instead. If a pattern conflicts with the catch-all parameters
+// of the routes registered before, those are moved out of httprouter.
+// Other conflicts cause a panic naming the patterns of both routes.
+func (router *Router) register(method string, route *Route, p string, routes *routeList, h http.Handler) {
+	rcv := tryRegister(router.r, method, p, routes, h)
+	if rcv == nil {
+		return
+	}
+
+	if strings.Contains(p, "*") {
+		router.addWildcard(method, p, routes, h)
+		return
+	}
+
+	moved := false
+	for q, list := range router.routes[method] {
+		i := strings.Index(q, "*")
+		if i < 0 || router.global.wildcard(method, q) != nil || !strings.HasPrefix(p, q[:i]) {
+			continue
+		}
+
+		router.addWildcard(method, q, list, nil)
+		moved = true
+	}
+	if !moved {
+		router.conflict(method, route, p, rcv)
+	}
+
+	router.rebuild()
+
+	if rcv := tryRegister(router.r, method, p, routes, h); rcv != nil {
+		router.conflict(method, route, p, rcv)
+	}
+}
+
+// conflict removes the pattern of the route, which cannot be registered in httprouter,
+// and panics with a message naming the pattern of a route it conflicts with.
+func (router *Router) conflict(method string, route *Route, p string, rcv interface{}) {
+	delete(router.routes[method], p)
+
+	for q, list := range router.routes[method] {
+		if len(*list) == 0 || router.global.wildcard(method, q) != nil {
+			continue
+		}
+
+		r := httprouter.New()
+		r.Handler(method, q, http.NotFoundHandler())
+		if tryRegister(r, method, p, nil, http.NotFoundHandler()) != nil {
+			panic(fmt.Sprintf("conflicting routes: %s %s and %s %s (%v)",
+				method, route.pattern, method, (*list)[0].pattern, rcv,
+			))
+		}
+	}
+
+	panic(fmt.Sprintf("conflicting routes: %s %s (%v)", method, route.pattern, rcv))
+}
+
+// tryRegister registers the handler of the routes in httprouter, and returns the value of the panic if it fails.
+func tryRegister(r *httprouter.Router, method string, p string, routes *routeList, h http.Handler) (rcv interface{}) {
+	defer func() {
+		rcv = recover()
+	}()
+
+	r.Handle(method, p, routesHandle(routes, h))
+	return nil
+}
+
+// addWildcard adds the routes to be matched by the router.
+// If h is nil, the handler the routes have been registered with is used.
+func (router *Router) addWildcard(method string, p string, routes *routeList, h http.Handler) {
+	if h == nil {
+		h = router.handlers[routes]
+	}
+
+	global := router.global
+	global.installDispatch(router.r)
+
+	global.wildcards = append(global.wildcards, wildcardHandler{
+		method:  method,
+		pattern: p,
+		regexp:  wildcardRegexp(p),
+		depth:   strings.Count(p, "/"),
+		routes:  routes,
+		handler: h,
+	})
+
+	sort.SliceStable(global.wildcards, func(i, j int) bool {
+		return global.wildcards[i].depth > global.wildcards[j].depth
+	})
+}
+
+// rebuild registers the routes in a new instance of httprouter, except the routes matched by the router,
+// and replaces the current instance with it, since httprouter does not support removing routes.
+// The handlers the routes have been registered with are reused, so they keep their middleware,
+// and are not wrapped in the middleware added to the router afterwards.
+func (router *Router) rebuild() {
+	r := httprouter.New()
+	r.RedirectTrailingSlash = router.r.RedirectTrailingSlash
+	r.RedirectFixedPath = router.r.RedirectFixedPath
+	r.HandleMethodNotAllowed = router.r.HandleMethodNotAllowed
+	r.HandleOPTIONS = router.r.HandleOPTIONS
+	r.GlobalOPTIONS = router.r.GlobalOPTIONS
+	r.NotFound = router.r.NotFound
+	r.MethodNotAllowed = router.r.MethodNotAllowed
+	r.PanicHandler = router.r.PanicHandler
+
+	for method, m := range router.routes {
+		for p, list := range m {
+			if len(*list) == 0 || router.global.wildcard(method, p) != nil {
+				continue
+			}
+
+			r.Handle(method, p, routesHandle(list, router.handlers[list]))
+		}
+	}
+
+	*router.r = *r
+}
+
+// wildcard returns the handler of the routes with the pattern matched by the router, or nil.
+func (global *globalHandler) wildcard(method string, p string) *wildcardHandler {
+	for i := range global.wildcards {
+		if global.wildcards[i].method == method && global.wildcards[i].pattern == p {
+			return &global.wildcards[i]
+		}
+	}
+	return nil
+}
+
+// matchWildcard returns the deepest routes matched by the router for the method and the path,
+// with the parameters in the format of httprouter.
+func (global *globalHandler) matchWildcard(method string, path string) (*wildcardHandler, httprouter.Params) {
+	for i := range global.wildcards {
+		w := &global.wildcards[i]
+		if w.method != method {
+			continue
+		}
+
+		m := w.regexp.FindStringSubmatch(path)
+		if m == nil {
+			continue
+		}
+
+		params := make(httprouter.Params, len(m)-1)
+		for i, v := range m[1:] {
+			params[i].Value = v
+		}
+		return w, params
+	}
+	return nil, nil
+}
+
+// matchesWildcard reports whether the routes matched by the router for the method match the path.
+func (global *globalHandler) matchesWildcard(method string, path string) bool {
+	for i := range global.wildcards {
+		if w := &global.wildcards[i]; w.method == method && w.regexp.MatchString(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// wildcardMethods returns the methods other than the given one and OPTIONS,
+// whose routes matched by the router match the path.
+func (global *globalHandler) wildcardMethods(path string, method string) []string {
+	var methods []string
+	for i := range global.wildcards {
+		w := &global.wildcards[i]
+		if w.method == method || w.method == http.MethodOptions || hasMethod(methods, w.method) {
+			continue
+		}
+		if w.regexp.MatchString(path) {
+			methods = append(methods, w.method)
+		}
+	}
+	return methods
+}
+
+// allowHeader returns the value of the Allow header for the methods as httprouter formats it:
+// sorted, with OPTIONS, and separated by commas.
+func allowHeader(methods []string) string {
+	a := append(make([]string, 0, len(methods)+1), methods...)
+	if !hasMethod(a, http.MethodOptions) {
+		a = append(a, http.MethodOptions)
+	}
+	sort.Strings(a)
+	return strings.Join(a, ", ")
+}
+
+// serveWildcard calls the handler of the routes matched by the router, and reports whether there are any.
+// Each request is only tried once, since the handler calls the NotFound handler if no route accepts it.
+func (global *globalHandler) serveWildcard(w http.ResponseWriter, r *http.Request, method string) bool {
+	if len(global.wildcards) == 0 || r.Context().Value(wildcardKey) != nil {
+		return false
+	}
+
+	wildcard, params := global.matchWildcard(method, r.URL.Path)
+	if wildcard == nil {
+		return false
+	}
+
+	ctx := context.WithValue(r.Context(), wildcardKey, true)
+	ctx = context.WithValue(ctx, httprouter.ParamsKey, params)
+	wildcard.handler.ServeHTTP(w, r.WithContext(ctx))
+	return true
+}
+
+// wildcardRegexp converts a pattern in the syntax of httprouter to a regular expression
+// matching the same paths, with a group for each parameter.
+func wildcardRegexp(p string) *regexp.Regexp {
+	expr := "^"
+	last := 0
+	for _, loc := range httpRouterParamRegexp.FindAllStringSubmatchIndex(p, -1) {
+		expr += regexp.QuoteMeta(p[last:loc[0]])
+		if loc[2] >= 0 {
+			expr += "(/.*)"
+		} else {
+			expr += "([^/]+)"
+		}
+		last = loc[1]
+	}
+	expr += regexp.QuoteMeta(p[last:]) + "$"
+
+	return regexp.MustCompile(expr)
+}